@@ -1,46 +1,146 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"greenlight.aida.kz/internal/data"
 	"greenlight.aida.kz/internal/validator"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 func (app *application) createAnimeHandler(w http.ResponseWriter, r *http.Request) {
+	anime, err := app.readAnimeCreate(w, r)
+	if err != nil {
+		app.readAnimeCreateErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateAnime(v, anime); !v.Valid() {
+		app.failedAnimeValidationResponse(w, r, anime, v.Errors)
+		return
+	}
+	app.insertAnime(w, r, anime)
+}
+
+// fieldWarning describes something about a field in a request which doesn't stop it
+// from being processed, but which the client might want to act on.
+type fieldWarning struct {
+	Field       string   `json:"field"`
+	Message     string   `json:"message"`
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// The animeWarnings() helper returns the warnings for an anime which is being
+// created. At the moment this is only the genres suggested by the
+// -genre-inference-rules when the anime has no genres; they are never applied
+// automatically.
+func (app *application) animeWarnings(anime *data.Anime) []fieldWarning {
+	if len(anime.Genres) > 0 || len(app.config.genreInference.rules) == 0 {
+		return nil
+	}
+	suggestions := data.InferGenres(anime.Title, app.config.genreInference.rules)
+	if len(suggestions) == 0 {
+		return nil
+	}
+	return []fieldWarning{{
+		Field:       "genres",
+		Message:     "no genres were provided, these were suggested based on the title",
+		Suggestions: suggestions,
+	}}
+}
+
+// The failedAnimeValidationResponse() method sends the 422 response for an anime
+// which failed validation, including any warnings for it alongside the errors.
+func (app *application) failedAnimeValidationResponse(w http.ResponseWriter, r *http.Request, anime *data.Anime, errors map[string]string) {
+	var extra envelope
+	if warnings := app.animeWarnings(anime); warnings != nil {
+		extra = envelope{"warnings": warnings}
+	}
+	app.errorResponseWith(w, r, http.StatusUnprocessableEntity, errors, extra)
+}
+
+// The readAnimeCreateErrorResponse() method sends the response for an error returned
+// by readAnimeCreate(). A body which fails the schema because it has no genres still
+// gets the genres suggested for its title.
+func (app *application) readAnimeCreateErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var se *schemaError
+	if errors.As(err, &se) {
+		if body, ok := se.doc.(map[string]any); ok {
+			genres, isArray := body["genres"].([]any)
+			if _, given := body["genres"]; !given || (isArray && len(genres) == 0) {
+				title, _ := body["title"].(string)
+				anime := &data.Anime{Title: data.SanitizeText(title, app.config.sanitizeHTML)}
+				app.failedAnimeValidationResponse(w, r, anime, se.errors)
+				return
+			}
+		}
+	}
+	app.readJSONErrorResponse(w, r, err)
+}
+
+// The readAnimeCreate() helper reads the body of a request to create an anime, and
+// returns the anime it describes with its title and genres sanitized and normalized,
+// and the defaults filled in for any omitted fields. The anime still needs to be
+// validated.
+func (app *application) readAnimeCreate(w http.ResponseWriter, r *http.Request) (*data.Anime, error) {
 	var input struct {
-		Title   string       `json:"title"`
-		Year    int32        `json:"year"`
-		Runtime data.Runtime `json:"runtime"`
-		Genres  []string     `json:"genres"`
+		Title         string       `json:"title"`
+		Year          int32        `json:"year"`
+		Runtime       data.Runtime `json:"runtime"`
+		Genres        []string     `json:"genres"`
+		MediaType     string       `json:"media_type"`
+		EpisodesCount *int32       `json:"episodes_count"`
+		Status        string       `json:"status"`
 	}
-	err := app.readJSON(w, r, &input)
+	err := app.readJSONWithSchema(w, r, &input, "anime_create")
 	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+		return nil, err
 	}
 	// Note that the variable contains a *pointer* to a struct.
 	anime := &data.Anime{
-		Title:   input.Title,
-		Year:    input.Year,
-		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Title:         data.SanitizeText(input.Title, app.config.sanitizeHTML),
+		Year:          input.Year,
+		Runtime:       input.Runtime,
+		Genres:        data.NormalizeGenres(data.SanitizeGenres(input.Genres, app.config.sanitizeHTML), app.config.genreSynonyms),
+		MediaType:     input.MediaType,
+		EpisodesCount: input.EpisodesCount,
+		Status:        input.Status,
 	}
-	v := validator.New()
-	if data.ValidateAnime(v, anime); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
+	data.SetAnimeDefaults(anime)
+	return anime, nil
+}
+
+// The creator() helper returns the ID of the user to record as the creator of the
+// animes created by a request.
+func (app *application) creator(r *http.Request) *int64 {
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() {
+		return nil
 	}
+	return &user.ID
+}
+
+// The insertAnime() helper inserts a validated anime and sends the 201 Created
+// response for it.
+func (app *application) insertAnime(w http.ResponseWriter, r *http.Request, anime *data.Anime) {
+	anime.CreatedBy = app.creator(r)
 	// Call the Insert() method on ours model, passing in a pointer to the
 	// validated struct. This will create a record in the database and update the
 	// struct with the system-generated information.
-	err = app.models.Animes.Insert(anime)
+	err := app.models.Animes.Insert(app.dbContext(r), anime)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrDuplicateAnime):
+			app.failedValidationResponse(w, r, map[string]string{"title": data.DuplicateTitleMessage()})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
+	app.audit(r, data.AuditCreate, "anime", anime.ID)
 	// When sending a HTTP response, we want to include a Location header to let the
 	// client know which URL they can find the newly-created resource at. We make an
 	// empty http.Header map and then use the Set() method to add a new Location header,
@@ -49,7 +149,7 @@ func (app *application) createAnimeHandler(w http.ResponseWriter, r *http.Reques
 	headers.Set("Location", fmt.Sprintf("/v1/animes/%d", anime.ID))
 	// Write a JSON response with a 201 Created status code, the data in the
 	// response body, and the Location header.
-	err = app.writeJSON(w, http.StatusCreated, envelope{"anime": anime}, headers)
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"anime": app.presentAnime(r, anime)}, headers)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -64,7 +164,7 @@ func (app *application) showAnimeHandler(w http.ResponseWriter, r *http.Request)
 	// Call the Get() method to fetch the data for a specific. We also need to
 	// use the errors.Is() function to check if it returns a data.ErrRecordNotFound
 	// error, in which case we send a 404 Not Found response to the client.
-	anime, err := app.models.Animes.Get(id)
+	anime, err := app.models.Animes.Get(app.dbContext(r), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -74,7 +174,7 @@ func (app *application) showAnimeHandler(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"anime": anime}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"anime": app.presentAnime(r, anime)}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -89,7 +189,7 @@ func (app *application) updateAnimeHandler(w http.ResponseWriter, r *http.Reques
 	}
 	// Fetch the existing record from the database, sending a 404 Not Found
 	// response to the client if we couldn't find a matching record.
-	anime, err := app.models.Animes.Get(id)
+	anime, err := app.models.Animes.Get(app.dbContext(r), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -109,41 +209,71 @@ func (app *application) updateAnimeHandler(w http.ResponseWriter, r *http.Reques
 
 	// Declare an input struct to hold the expected data from the client.
 	var input struct {
-		Title   *string       `json:"title"`
-		Year    *int32        `json:"year"`
-		Runtime *data.Runtime `json:"runtime"`
-		Genres  []string      `json:"genres"`
+		Title         *string       `json:"title"`
+		Year          *int32        `json:"year"`
+		Runtime       *data.Runtime `json:"runtime"`
+		Genres        []string      `json:"genres"`
+		MediaType     *string       `json:"media_type"`
+		EpisodesCount *int32        `json:"episodes_count"`
+		Status        *string       `json:"status"`
 	}
 	// Read the JSON request body data into the input struct.
-	err = app.readJSON(w, r, &input)
+	err = app.readJSONWithSchema(w, r, &input, "anime_update")
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.readJSONErrorResponse(w, r, err)
 		return
 	}
+	// Keep track of the fields the client changed, for field-scoped validation.
+	changed := make(map[string]bool)
 	if input.Title != nil {
-		anime.Title = *input.Title
+		anime.Title = data.SanitizeText(*input.Title, app.config.sanitizeHTML)
+		changed["title"] = true
 	}
 	// We also do the same for the other fields in the input struct.
 	if input.Year != nil {
 		anime.Year = *input.Year
+		changed["year"] = true
 	}
 	if input.Runtime != nil {
 		anime.Runtime = *input.Runtime
+		changed["runtime"] = true
 	}
 	if input.Genres != nil {
-		anime.Genres = input.Genres // Note that we don't need to dereference a slice.
+		anime.Genres = data.NormalizeGenres(data.SanitizeGenres(input.Genres, app.config.sanitizeHTML), app.config.genreSynonyms)
+		changed["genres"] = true
+	}
+	if input.MediaType != nil {
+		anime.MediaType = *input.MediaType
+		changed["media_type"] = true
+	}
+	if input.EpisodesCount != nil {
+		anime.EpisodesCount = input.EpisodesCount
+		changed["episodes_count"] = true
+	}
+	if input.Status != nil {
+		anime.Status = *input.Status
+		changed["status"] = true
 	}
 	// Validate the updated record, sending the client a 422 Unprocessable Entity
-	// response if any checks fail.
+	// response if any checks fail. In "changed" mode only the fields the client sent
+	// (and the fields which depend on them) are checked.
 	v := validator.New()
-	if data.ValidateAnime(v, anime); !v.Valid() {
+	if app.config.patch.validation == "changed" {
+		data.ValidateAnimeFields(v, anime, changed)
+	} else {
+		data.ValidateAnime(v, anime)
+	}
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 	// Pass the updated record to our new Update() method.
-	err = app.models.Animes.Update(anime)
+	err = app.models.Animes.Update(app.dbContext(r), anime)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrDuplicateAnime):
+			v.AddError("title", data.DuplicateTitleMessage())
+			app.failedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrEditConflict):
 			app.editConflictResponse(w, r)
 		default:
@@ -151,7 +281,8 @@ func (app *application) updateAnimeHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
-	err = app.writeJSON(w, http.StatusOK, envelope{"anime": anime}, nil)
+	app.audit(r, data.AuditUpdate, "anime", anime.ID)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"anime": app.presentAnime(r, anime)}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -167,7 +298,7 @@ func (app *application) deleteAnimeHandler(w http.ResponseWriter, r *http.Reques
 	}
 	// Delete the from the database, sending a 404 Not Found response to the
 	// client if there isn't a matching record.
-	err = app.models.Animes.Delete(id)
+	err = app.models.Animes.Delete(app.dbContext(r), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -177,31 +308,60 @@ func (app *application) deleteAnimeHandler(w http.ResponseWriter, r *http.Reques
 		}
 		return
 	}
+	app.audit(r, data.AuditDelete, "anime", id)
 	// Return a 200 OK status code along with a success message.
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "anime successfully deleted"}, nil)
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"message": "anime successfully deleted"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// animeSortSafelist holds the sort values accepted by the anime listing, apart from
+// relevance which is only accepted along with a title query.
+var animeSortSafelist = []string{"id", "title", "year", "runtime", "created_at", "updated_at", "-id", "-title", "-year", "-runtime", "-created_at", "-updated_at"}
+
+// The relevanceFallback() helper replaces a relevance sort with the
+// -list-relevance-fallback sort when there is no title query to rank the titles
+// against, rather than failing the request, and returns a warning saying so.
+func (app *application) relevanceFallback(filters *data.Filters, title string) []fieldWarning {
+	if (filters.Sort != "relevance" && filters.Sort != "-relevance") || title != "" {
+		return nil
+	}
+	filters.Sort = app.config.list.relevanceFallback
+	return []fieldWarning{{
+		Field:   "sort",
+		Message: fmt.Sprintf("sorting by relevance needs a title query, so the results are sorted by %s instead", app.config.list.relevanceFallback),
+	}}
+}
+
 func (app *application) listAnimesHandler(w http.ResponseWriter, r *http.Request) {
 	// Embed the new Filters struct.
 	var input struct {
-		Title  string
-		Genres []string
+		data.AnimeQuery
 		data.Filters
 	}
 	v := validator.New()
 	qs := r.URL.Query()
 	input.Title = app.readString(qs, "title", "")
-	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.Genres = data.NormalizeGenres(app.readCSV(qs, "genres", []string{}), app.config.genreSynonyms)
+	input.MediaType = app.readString(qs, "media_type", "")
+	if input.MediaType != "" {
+		v.Check(validator.PermittedValue(input.MediaType, data.MediaTypes...), "media_type", "must be one of "+strings.Join(data.MediaTypes, ", "))
+	}
+	input.Status = app.readString(qs, "status", "")
+	if input.Status != "" {
+		v.Check(validator.PermittedValue(input.Status, data.Statuses...), "status", "must be one of "+strings.Join(data.Statuses, ", "))
+	}
+	input.IncludeDeleted = app.readBool(qs, "include_deleted", false, v)
+	data.ValidateAnimeQuery(v, input.AnimeQuery)
 	// Read the page and page_size query string values into the embedded struct.
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	// Read the sort query string value into the embedded struct.
-	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.Sort = data.ResolveSortAlias(app.readString(qs, "sort", "id"), app.config.sortAliases)
+	warnings := app.relevanceFallback(&input.Filters, input.Title)
 
-	input.Filters.SortSafelist = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafelist = append([]string{"relevance", "-relevance"}, animeSortSafelist...)
 	// Execute the validation checks on the Filters struct and send a response
 	// containing the errors if necessary.
 	if data.ValidateFilters(v, input.Filters); !v.Valid() {
@@ -209,15 +369,93 @@ func (app *application) listAnimesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	animes, metadata, err := app.models.Animes.GetAll(input.Title, input.Genres, input.Filters)
+	// Soft-deleted animes are only visible to admins. The permissions are normally
+	// already in the context from requirePermission().
+	if input.IncludeDeleted {
+		permissions, ok := app.contextGetPermissions(r)
+		if !ok {
+			var err error
+			permissions, err = app.models.Permissions.GetAllForUser(app.dbContext(r), app.contextGetUser(r).ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		if !permissions.Include("animes:admin") {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+
+	w.Header().Add("Vary", "Accept")
+	if app.streamList(r, input.Filters.PageSize) {
+		app.streamAnimes(w, r, input.AnimeQuery, input.Filters)
+		return
+	}
+
+	animes, metadata, err := app.models.Animes.GetAll(app.dbContext(r), input.AnimeQuery, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusOK, envelope{"animes": animes, "metadata": metadata}, nil)
+	env := envelope{"animes": app.presentAnimes(r, animes), "metadata": metadata}
+	if warnings != nil {
+		env["warnings"] = warnings
+	}
+	err = app.writeJSON(w, r, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 
 }
+
+// The streamList() helper reports whether a listing should be streamed as NDJSON
+// rather than buffered as a single JSON document. Clients can ask for either with the
+// Accept header; otherwise pages larger than the -list-stream-threshold are streamed.
+func (app *application) streamList(r *http.Request, pageSize int) bool {
+	switch {
+	case acceptsMediaType(r, "application/x-ndjson"):
+		return true
+	case acceptsMediaType(r, "application/json"):
+		return false
+	default:
+		return app.config.list.streamThreshold > 0 && pageSize > app.config.list.streamThreshold
+	}
+}
+
+// The streamAnimes() helper writes a page of animes as NDJSON, one anime per line,
+// as each is read from the database. The pagination metadata isn't included, and the
+// stream counts towards the -max-streams limit. If the query fails before anything
+// has been written an error response is sent as usual; after that the error can only
+// be logged.
+func (app *application) streamAnimes(w http.ResponseWriter, r *http.Request, q data.AnimeQuery, filters data.Filters) {
+	release, ok := app.acquireStream()
+	if !ok {
+		app.serviceUnavailableResponse(w, r, 0)
+		return
+	}
+	defer release()
+
+	wroteHeader := false
+	writeHeader := func() {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		wroteHeader = true
+	}
+	enc := json.NewEncoder(w)
+	_, err := app.models.Animes.GetAllFunc(app.dbContext(r), q, filters, func(anime *data.Anime) error {
+		if !wroteHeader {
+			writeHeader()
+		}
+		return enc.Encode(app.presentAnime(r, anime))
+	})
+	switch {
+	case err != nil && !wroteHeader:
+		app.serverErrorResponse(w, r, err)
+	case err != nil:
+		app.logError(r, err)
+	case !wroteHeader:
+		writeHeader()
+	}
+}
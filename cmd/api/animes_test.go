@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"greenlight.aida.kz/internal/data"
+	"greenlight.aida.kz/internal/validator"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCreateAnimeHandlerSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   map[string]string
+	}{
+		{
+			name:   "missing fields",
+			body:   `{"title": "Akira"}`,
+			status: http.StatusUnprocessableEntity,
+			want: map[string]string{
+				"year":    "must be provided",
+				"runtime": "must be provided",
+				"genres":  "must be provided",
+			},
+		},
+		{
+			name:   "wrong types and formats",
+			body:   `{"title": "Akira", "year": "1988", "runtime": "124", "genres": [1], "media_type": "Film", "status": "finished"}`,
+			status: http.StatusUnprocessableEntity,
+			want: map[string]string{
+				"year":       "must be of type integer",
+				"runtime":    `must match the pattern "^[0-9]+ mins$"`,
+				"genres[0]":  "must be of type string",
+				"media_type": "must be one of [TV Movie OVA Special]",
+			},
+		},
+		{
+			name:   "unknown field",
+			body:   `{"title": "Akira", "year": 1988, "runtime": "124 mins", "genres": ["Sci-Fi"], "media_type": "Movie", "status": "finished", "episodes_count": 1, "rating": 5}`,
+			status: http.StatusUnprocessableEntity,
+			want:   map[string]string{"rating": "is not a permitted field"},
+		},
+		{
+			name:   "valid schema but failed validation",
+			body:   `{"title": "Akira", "year": 1988, "runtime": "124 mins", "genres": ["Sci-Fi", "Sci-Fi"], "media_type": "Movie", "status": "finished", "episodes_count": 1}`,
+			status: http.StatusUnprocessableEntity,
+			want:   map[string]string{"genres": "must not contain duplicate values"},
+		},
+		{
+			name:   "badly-formed JSON",
+			body:   `{"title": `,
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := httptest.NewRecorder()
+			app.createAnimeHandler(rr, app.newRequest(http.MethodPost, "/v1/animes", tt.body, data.AnonymousUser))
+
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d; want %d (body: %s)", rr.Code, tt.status, rr.Body)
+			}
+			if tt.want == nil {
+				return
+			}
+			errs := decodeErrors(t, rr)
+			if len(errs) != len(tt.want) {
+				t.Errorf("errors = %v; want %v", errs, tt.want)
+			}
+			for key, message := range tt.want {
+				if errs[key] != message {
+					t.Errorf("errors[%q] = %q; want %q", key, errs[key], message)
+				}
+			}
+		})
+	}
+}
+
+func TestReadAnimeCreateDefaults(t *testing.T) {
+	// A body from a client which predates the media type and status fields.
+	app := newTestApplication(t)
+	r := app.newRequest(http.MethodPost, "/v1/animes", `{"title": "Akira", "year": 1988, "runtime": "124 mins", "genres": ["Sci-Fi"]}`, data.AnonymousUser)
+	anime, err := app.readAnimeCreate(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anime.MediaType != data.MediaTV || anime.Status != data.StatusUnknown {
+		t.Errorf("media type %q, status %q; want the column defaults", anime.MediaType, anime.Status)
+	}
+	v := validator.New()
+	if data.ValidateAnime(v, anime); !v.Valid() {
+		t.Errorf("errors = %v; want none", v.Errors)
+	}
+}
+
+func TestListAnimesHandlerIncludeDeleted(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		permissions data.Permissions
+		status      int
+		wantError   string
+	}{
+		{"not an admin", "include_deleted=true", data.Permissions{"animes:read"}, http.StatusForbidden, ""},
+		{"not a boolean", "include_deleted=maybe", data.Permissions{"animes:read", "animes:admin"}, http.StatusUnprocessableEntity, "must be a boolean value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			r := app.newRequest(http.MethodGet, "/v1/animes?"+tt.query, "", &data.User{ID: 1, Activated: true})
+			r = app.contextSetPermissions(r, tt.permissions)
+			rr := httptest.NewRecorder()
+			app.listAnimesHandler(rr, r)
+
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d; want %d (body: %s)", rr.Code, tt.status, rr.Body)
+			}
+			if tt.wantError != "" {
+				if got := decodeErrors(t, rr)["include_deleted"]; got != tt.wantError {
+					t.Errorf("errors[include_deleted] = %q; want %q", got, tt.wantError)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamList(t *testing.T) {
+	tests := []struct {
+		name      string
+		accept    string
+		threshold int
+		pageSize  int
+		want      bool
+	}{
+		{"small page", "", 50, 20, false},
+		{"at threshold", "", 50, 50, false},
+		{"above threshold", "", 50, 51, true},
+		{"automatic streaming off", "", 0, 100, false},
+		{"ndjson requested", "application/x-ndjson", 50, 20, true},
+		{"json requested", "application/json", 50, 100, false},
+		{"wildcard", "*/*", 50, 100, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.list.streamThreshold = tt.threshold
+			r := httptest.NewRequest(http.MethodGet, "/v1/animes", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			if got := app.streamList(r, tt.pageSize); got != tt.want {
+				t.Errorf("streamList() = %t; want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamAnimesQueryError(t *testing.T) {
+	app := newTestApplication(t)
+	app.models = data.NewModels(newRefusingDB(t))
+	r := app.newRequest(http.MethodGet, "/v1/animes", "", &data.User{ID: 1, Activated: true})
+	r.Header.Set("Accept", "application/x-ndjson")
+	r = app.contextSetPermissions(r, data.Permissions{"animes:read"})
+	rr := httptest.NewRecorder()
+	app.listAnimesHandler(rr, r)
+
+	// Nothing has been streamed when the query fails, so a normal error is sent.
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d; want %d", rr.Code, http.StatusInternalServerError)
+	}
+	if got := rr.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q; want application/json", got)
+	}
+	if got := rr.Header().Values("Vary"); len(got) == 0 || got[0] != "Accept" {
+		t.Errorf("Vary = %q; want it to start with Accept", got)
+	}
+}
+
+func TestCreateAnimeHandlerGenreWarnings(t *testing.T) {
+	rules := map[string]string{"school": "School", "mecha": "Mecha"}
+	tests := []struct {
+		name  string
+		rules map[string]string
+		body  string
+		want  []fieldWarning
+	}{
+		{
+			name:  "suggested",
+			rules: rules,
+			body:  `{"title": "Mecha School", "year": 2020, "runtime": "24 mins", "genres": [], "media_type": "TV", "status": "airing"}`,
+			want: []fieldWarning{{
+				Field:       "genres",
+				Message:     "no genres were provided, these were suggested based on the title",
+				Suggestions: []string{"Mecha", "School"},
+			}},
+		},
+		{
+			name:  "genres omitted",
+			rules: rules,
+			body:  `{"title": "School Days", "year": 2007, "runtime": "24 mins", "media_type": "TV", "status": "airing"}`,
+			want: []fieldWarning{{
+				Field:       "genres",
+				Message:     "no genres were provided, these were suggested based on the title",
+				Suggestions: []string{"School"},
+			}},
+		},
+		{
+			name:  "no matching keyword",
+			rules: rules,
+			body:  `{"title": "Mushishi", "year": 2005, "runtime": "24 mins", "genres": [], "media_type": "TV", "status": "airing"}`,
+		},
+		{
+			name: "no rules",
+			body: `{"title": "Mecha School", "year": 2020, "runtime": "24 mins", "genres": [], "media_type": "TV", "status": "airing"}`,
+		},
+		{
+			name:  "genres provided",
+			rules: rules,
+			body:  `{"title": "Mecha School", "year": 1700, "runtime": "24 mins", "genres": ["Comedy"], "media_type": "TV", "status": "airing"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.genreInference.rules = tt.rules
+			rr := httptest.NewRecorder()
+			app.createAnimeHandler(rr, app.newRequest(http.MethodPost, "/v1/animes", tt.body, data.AnonymousUser))
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d; want %d (body: %s)", rr.Code, http.StatusUnprocessableEntity, rr.Body)
+			}
+			var body struct {
+				Error    map[string]string `json:"error"`
+				Warnings []fieldWarning    `json:"warnings"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			// The warnings are sent alongside the errors, never instead of them.
+			if len(body.Error) == 0 {
+				t.Error("no errors in the response")
+			}
+			if !reflect.DeepEqual(body.Warnings, tt.want) {
+				t.Errorf("warnings = %+v; want %+v", body.Warnings, tt.want)
+			}
+		})
+	}
+}
+
+func TestListAnimesHandlerRelevanceFallback(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		// The fallback sort passes validation, so the request only fails once it
+		// reaches the (unreachable) database.
+		{"relevance without a title", "sort=relevance", http.StatusInternalServerError},
+		{"descending relevance without a title", "sort=-relevance", http.StatusInternalServerError},
+		{"relevance with a title", "sort=relevance&title=akira", http.StatusInternalServerError},
+		{"unknown sort", "sort=popularity", http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.models = data.NewModels(newRefusingDB(t))
+			app.config.list.relevanceFallback = "-created_at"
+			r := app.newRequest(http.MethodGet, "/v1/animes?"+tt.query, "", &data.User{ID: 1, Activated: true})
+			r = app.contextSetPermissions(r, data.Permissions{"animes:read"})
+			rr := httptest.NewRecorder()
+			app.listAnimesHandler(rr, r)
+
+			if rr.Code != tt.status {
+				t.Errorf("status = %d; want %d (body: %s)", rr.Code, tt.status, rr.Body)
+			}
+		})
+	}
+}
+
+func TestRelevanceFallback(t *testing.T) {
+	tests := []struct {
+		sort     string
+		title    string
+		wantSort string
+		warned   bool
+	}{
+		{"relevance", "", "-year", true},
+		{"-relevance", "", "-year", true},
+		{"relevance", "akira", "relevance", false},
+		{"title", "", "title", false},
+	}
+	for _, tt := range tests {
+		app := newTestApplication(t)
+		app.config.list.relevanceFallback = "-year"
+		filters := data.Filters{Sort: tt.sort}
+
+		warnings := app.relevanceFallback(&filters, tt.title)
+		if filters.Sort != tt.wantSort {
+			t.Errorf("sort %q, title %q: sort = %q; want %q", tt.sort, tt.title, filters.Sort, tt.wantSort)
+		}
+		if (warnings != nil) != tt.warned {
+			t.Errorf("sort %q, title %q: warnings = %+v; want warned: %t", tt.sort, tt.title, warnings, tt.warned)
+		}
+		want := "sorting by relevance needs a title query, so the results are sorted by -year instead"
+		if tt.warned && (warnings[0].Field != "sort" || warnings[0].Message != want) {
+			t.Errorf("warning = %+v; want %q for sort", warnings[0], want)
+		}
+	}
+}
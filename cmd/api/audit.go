@@ -0,0 +1,25 @@
+package main
+
+import (
+	"greenlight.aida.kz/internal/data"
+	"net/http"
+)
+
+// The audit() helper records a change made by the current request in the audit log.
+// A failure to write the entry is logged rather than failing the request, since the
+// change itself has already been made.
+func (app *application) audit(r *http.Request, action, targetType string, targetID int64) {
+	entry := &data.AuditEntry{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		RequestID:  app.contextGetRequestID(r),
+	}
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		entry.UserID = &user.ID
+	}
+	err := app.models.Audit.Insert(detach(app.dbContext(r)), entry)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
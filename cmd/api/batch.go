@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight.aida.kz/internal/data"
+	"greenlight.aida.kz/internal/validator"
+	"net/http"
+)
+
+func (app *application) createAnimesBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Animes []struct {
+			Title         string       `json:"title"`
+			Year          int32        `json:"year"`
+			Runtime       data.Runtime `json:"runtime"`
+			Genres        []string     `json:"genres"`
+			MediaType     string       `json:"media_type"`
+			EpisodesCount *int32       `json:"episodes_count"`
+			Status        string       `json:"status"`
+		} `json:"animes"`
+		OnDuplicate string `json:"on_duplicate"`
+	}
+	err := app.readJSONLimit(w, r, &input, app.config.batch.maxBodyBytes)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.OnDuplicate == "" {
+		input.OnDuplicate = app.config.batch.onDuplicate
+	}
+
+	v := validator.New()
+	// Reject oversized batches before doing any work on their items.
+	if v.Check(len(input.Animes) <= app.config.batch.maxItems, "animes", fmt.Sprintf("must not contain more than %d animes", app.config.batch.maxItems)); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	v.Check(len(input.Animes) > 0, "animes", "must contain at least 1 anime")
+	v.Check(validator.PermittedValue(input.OnDuplicate, data.DuplicatesSkip, data.DuplicatesFail), "on_duplicate", "must be skip or fail")
+
+	animes := make([]*data.Anime, len(input.Animes))
+	itemErrors := make([]map[string]string, len(input.Animes))
+	for i, item := range input.Animes {
+		animes[i] = &data.Anime{
+			Title:         data.SanitizeText(item.Title, app.config.sanitizeHTML),
+			Year:          item.Year,
+			Runtime:       item.Runtime,
+			Genres:        data.NormalizeGenres(data.SanitizeGenres(item.Genres, app.config.sanitizeHTML), app.config.genreSynonyms),
+			MediaType:     item.MediaType,
+			EpisodesCount: item.EpisodesCount,
+			Status:        item.Status,
+			CreatedBy:     app.creator(r),
+		}
+		data.SetAnimeDefaults(animes[i])
+		itemValidator := validator.New()
+		data.ValidateAnime(itemValidator, animes[i])
+		if !itemValidator.Valid() {
+			itemErrors[i] = itemValidator.Errors
+		}
+		// In DuplicatesFail mode the batch is all or nothing, so the errors for each
+		// anime are reported together, prefixed with the anime's position in the batch.
+		if input.OnDuplicate == data.DuplicatesFail {
+			for key, message := range itemValidator.Errors {
+				v.AddError(fmt.Sprintf("animes[%d].%s", i, key), message)
+			}
+		}
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.OnDuplicate == data.DuplicatesSkip {
+		app.createAnimesBatchPartial(w, r, animes, itemErrors)
+		return
+	}
+
+	report, err := app.models.Animes.InsertMany(app.dbContext(r), animes, input.OnDuplicate)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAnime):
+			app.errorResponse(w, r, http.StatusConflict, envelope{"conflicts": report.Conflicts})
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.refreshSearchAfterBatch(len(report.Inserted))
+
+	err = app.writeJSON(w, r, http.StatusCreated, envelope{"report": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// batchResult holds the outcome of a single item in a batch operation, identified by
+// its position in the batch. Status is the HTTP status code the item would have had
+// as a request of its own.
+type batchResult struct {
+	Index  int `json:"index"`
+	Status int `json:"status"`
+	Error  any `json:"error,omitempty"`
+	Data   any `json:"data,omitempty"`
+}
+
+// createAnimesBatchPartial() inserts the valid animes in a batch, skipping any
+// duplicates, and sends a 207 Multi-Status response with the outcome of every item:
+// 201 with the created anime, 422 with its validation errors, or 409 if it was a
+// duplicate.
+func (app *application) createAnimesBatchPartial(w http.ResponseWriter, r *http.Request, animes []*data.Anime, itemErrors []map[string]string) {
+	results := make([]batchResult, len(animes))
+	// positions maps the index of each anime passed to InsertMany() back to its
+	// index in the batch.
+	var valid []*data.Anime
+	var positions []int
+	for i, anime := range animes {
+		results[i].Index = i
+		if itemErrors[i] != nil {
+			results[i].Status = http.StatusUnprocessableEntity
+			results[i].Error = itemErrors[i]
+			continue
+		}
+		valid = append(valid, anime)
+		positions = append(positions, i)
+	}
+
+	if len(valid) > 0 {
+		report, err := app.models.Animes.InsertMany(app.dbContext(r), valid, data.DuplicatesSkip)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.refreshSearchAfterBatch(len(report.Inserted))
+		for _, conflict := range report.Conflicts {
+			i := positions[conflict.Index]
+			results[i].Status = http.StatusConflict
+			results[i].Error = conflict.Reason
+		}
+		for i, anime := range animes {
+			if itemErrors[i] == nil && results[i].Status == 0 {
+				results[i].Status = http.StatusCreated
+				results[i].Data = app.presentAnime(r, anime)
+			}
+		}
+	}
+
+	err := app.writeJSON(w, r, http.StatusMultiStatus, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"greenlight.aida.kz/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// validBatchItem is a JSON anime which passes validation, for building batches.
+const validBatchItem = `{"title": "Mushishi", "year": 2005, "runtime": "24 mins", "genres": ["Mystery"], "media_type": "TV", "episodes_count": 26, "status": "finished"}`
+
+func TestCreateAnimesBatchHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want map[string]string
+	}{
+		{
+			name: "unknown duplicate mode",
+			body: `{"animes": [` + validBatchItem + `], "on_duplicate": "merge"}`,
+			want: map[string]string{"on_duplicate": "must be skip or fail"},
+		},
+		{
+			name: "invalid items in fail mode",
+			body: `{"animes": [` + validBatchItem + `, {"title": "", "year": 2005, "runtime": "24 mins", "genres": ["Mystery"], "media_type": "TV", "episodes_count": 26, "status": "finished"}], "on_duplicate": "fail"}`,
+			want: map[string]string{"animes[1].title": "must be provided"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := httptest.NewRecorder()
+			app.createAnimesBatchHandler(rr, app.newRequest(http.MethodPost, "/v1/animes/batch", tt.body, data.AnonymousUser))
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d; want %d (body: %s)", rr.Code, http.StatusUnprocessableEntity, rr.Body)
+			}
+			errs := decodeErrors(t, rr)
+			for key, message := range tt.want {
+				if errs[key] != message {
+					t.Errorf("errors[%q] = %q; want %q (errors: %v)", key, errs[key], message, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateAnimesBatchHandlerDefaults(t *testing.T) {
+	// The first item omits its media type and status, which then take their defaults
+	// rather than failing validation.
+	body := `{"animes": [
+		{"title": "Akira", "year": 1988, "runtime": "124 mins", "genres": ["Sci-Fi"]},
+		{"title": "", "year": 2005, "runtime": "24 mins", "genres": ["Mystery"]}
+	], "on_duplicate": "fail"}`
+	app := newTestApplication(t)
+	rr := httptest.NewRecorder()
+	app.createAnimesBatchHandler(rr, app.newRequest(http.MethodPost, "/v1/animes/batch", body, data.AnonymousUser))
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d; want %d (body: %s)", rr.Code, http.StatusUnprocessableEntity, rr.Body)
+	}
+	want := map[string]string{"animes[1].title": "must be provided"}
+	if errs := decodeErrors(t, rr); !reflect.DeepEqual(errs, want) {
+		t.Errorf("errors = %v; want %v", errs, want)
+	}
+}
+
+func TestCreateAnimesBatchHandlerMultiStatus(t *testing.T) {
+	// Every item is invalid, so the skip-mode batch is answered without reaching the
+	// database.
+	body := `{"animes": [
+		{"title": "", "year": 2005, "runtime": "24 mins", "genres": ["Mystery"], "media_type": "TV", "episodes_count": 26, "status": "finished"},
+		{"title": "Mushishi", "year": 2005, "runtime": "24 mins", "genres": ["Mystery"], "media_type": "Film", "episodes_count": 26, "status": "finished"}
+	], "on_duplicate": "skip"}`
+	app := newTestApplication(t)
+	rr := httptest.NewRecorder()
+	app.createAnimesBatchHandler(rr, app.newRequest(http.MethodPost, "/v1/animes/batch", body, data.AnonymousUser))
+
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d; want %d (body: %s)", rr.Code, http.StatusMultiStatus, rr.Body)
+	}
+	var got struct {
+		Results []struct {
+			Index  int               `json:"index"`
+			Status int               `json:"status"`
+			Error  map[string]string `json:"error"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Results) != 2 {
+		t.Fatalf("got %d results; want 2", len(got.Results))
+	}
+	wantFields := []string{"title", "media_type"}
+	for i, result := range got.Results {
+		if result.Index != i || result.Status != http.StatusUnprocessableEntity {
+			t.Errorf("results[%d] = index %d, status %d; want index %d, status %d", i, result.Index, result.Status, i, http.StatusUnprocessableEntity)
+		}
+		if _, ok := result.Error[wantFields[i]]; !ok {
+			t.Errorf("results[%d].error = %v; want an error for %q", i, result.Error, wantFields[i])
+		}
+	}
+}
+
+func TestCreateAnimesBatchHandlerLimits(t *testing.T) {
+	// Invalid items are reported without reaching the database.
+	const invalidItem = `{"title": "", "year": 2005, "runtime": "24 mins", "genres": ["Mystery"], "media_type": "TV", "episodes_count": 26, "status": "finished"}`
+	batch := func(n int) string {
+		items := make([]string, n)
+		for i := range items {
+			items[i] = invalidItem
+		}
+		return `{"animes": [` + strings.Join(items, ",") + `], "on_duplicate": "skip"}`
+	}
+	tests := []struct {
+		name         string
+		maxItems     int
+		maxBodyBytes int64
+		body         string
+		status       int
+		want         string
+	}{
+		{"at the item limit", 2, 1_048_576, batch(2), http.StatusMultiStatus, ""},
+		{"over the item limit", 2, 1_048_576, batch(3), http.StatusUnprocessableEntity, "must not contain more than 2 animes"},
+		{"over the body limit", 100, 200, batch(3), http.StatusBadRequest, "body must not be larger than 200 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.batch.maxItems = tt.maxItems
+			app.config.batch.maxBodyBytes = tt.maxBodyBytes
+			rr := httptest.NewRecorder()
+			app.createAnimesBatchHandler(rr, app.newRequest(http.MethodPost, "/v1/animes/batch", tt.body, data.AnonymousUser))
+
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d; want %d (body: %s)", rr.Code, tt.status, rr.Body)
+			}
+			switch tt.status {
+			case http.StatusUnprocessableEntity:
+				if got := decodeErrors(t, rr)["animes"]; got != tt.want {
+					t.Errorf("errors[animes] = %q; want %q", got, tt.want)
+				}
+			case http.StatusBadRequest:
+				if !strings.Contains(rr.Body.String(), tt.want) {
+					t.Errorf("body = %s; want %q", rr.Body, tt.want)
+				}
+			}
+		})
+	}
+}
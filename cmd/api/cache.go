@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+)
+
+// routeCachePolicies holds the Cache-Control header sent with successful GET and HEAD
+// responses for each route, keyed by route pattern. Routes which aren't listed here
+// don't get a Cache-Control header. Responses to authenticated requests and error
+// responses are never cached, whatever the route's policy. The anime routes
+// need the animes:read permission, so their responses are always authenticated and
+// have no policy of their own.
+var routeCachePolicies = map[string]string{
+	"/":               "public, max-age=3600",
+	"/v1/healthcheck": "no-cache",
+	"/readyz":         "no-store",
+}
+
+// cacheResponseWriter sets the Cache-Control header when the status code for the
+// response is written, by which point the route that handled the request is known.
+type cacheResponseWriter struct {
+	http.ResponseWriter
+	app         *application
+	r           *http.Request
+	wroteHeader bool
+}
+
+func (cw *cacheResponseWriter) setCacheControl(statusCode int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	switch {
+	case statusCode < 200 || statusCode >= 300, !cw.app.contextGetUser(cw.r).IsAnonymous():
+		cw.Header().Set("Cache-Control", "no-store")
+	default:
+		if policy, ok := routeCachePolicies[cw.app.routePattern(cw.r)]; ok {
+			cw.Header().Set("Cache-Control", policy)
+		}
+	}
+}
+
+func (cw *cacheResponseWriter) WriteHeader(statusCode int) {
+	cw.setCacheControl(statusCode)
+	cw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (cw *cacheResponseWriter) Write(b []byte) (int, error) {
+	cw.setCacheControl(http.StatusOK)
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *cacheResponseWriter) Flush() {
+	cw.setCacheControl(http.StatusOK)
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *cacheResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// The cacheControl() middleware applies the route's policy from routeCachePolicies to
+// GET and HEAD responses. It must come after authenticate() in the middleware chain.
+func (app *application) cacheControl(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&cacheResponseWriter{ResponseWriter: w, app: app, r: r}, r)
+	})
+}
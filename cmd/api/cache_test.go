@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"greenlight.aida.kz/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCacheControl(t *testing.T) {
+	user := &data.User{ID: 1, Activated: true}
+	tests := []struct {
+		name    string
+		method  string
+		pattern string
+		user    *data.User
+		status  int
+		want    string
+	}{
+		{"root", http.MethodGet, "/", data.AnonymousUser, http.StatusOK, "public, max-age=3600"},
+		{"head", http.MethodHead, "/", data.AnonymousUser, http.StatusOK, "public, max-age=3600"},
+		{"healthcheck", http.MethodGet, "/v1/healthcheck", data.AnonymousUser, http.StatusOK, "no-cache"},
+		{"route without a policy", http.MethodGet, "/v1/users/me", data.AnonymousUser, http.StatusOK, ""},
+		{"authenticated root", http.MethodGet, "/", user, http.StatusOK, "no-store"},
+		{"authenticated list", http.MethodGet, "/v1/animes", user, http.StatusOK, "no-store"},
+		{"authenticated route without a policy", http.MethodGet, "/v1/users/me", user, http.StatusOK, "no-store"},
+		{"error", http.MethodGet, "/", data.AnonymousUser, http.StatusNotFound, "no-store"},
+		{"not a GET", http.MethodPost, "/v1/animes", data.AnonymousUser, http.StatusCreated, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			handler := app.cacheControl(app.route(tt.pattern, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			r := app.newRequest(tt.method, "/", "", tt.user)
+			r = r.WithContext(context.WithValue(r.Context(), routeContextKey, &routeInfo{}))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, r)
+
+			if got := rr.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheControlRoutes(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/", "public, max-age=3600"},
+		{"/v1/healthcheck", "no-cache"},
+		// Anonymous users can't read animes, and the error isn't cached.
+		{"/v1/animes", "no-store"},
+		{"/v1/animes/1", "no-store"},
+		{"/v1/search?q=akira", "no-store"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := app.serveTest(t, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if got := rr.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheControlPoliciesReachable(t *testing.T) {
+	// A public policy is only useful on a route which anonymous users can read.
+	for pattern := range routeCachePolicies {
+		t.Run(pattern, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.db = newRefusingDB(t)
+			rr := app.serveTest(t, httptest.NewRequest(http.MethodGet, pattern, nil))
+
+			if rr.Code == http.StatusUnauthorized || rr.Code == http.StatusForbidden {
+				t.Errorf("status = %d; want the route to be readable anonymously", rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"greenlight.aida.kz/internal/data"
+	"greenlight.aida.kz/internal/validator"
+	"net/http"
+)
+
+// animeDraft is the validated anime stored in the payload of a commit token. It uses
+// plain field types so that the anime survives the round trip through JSON exactly.
+type animeDraft struct {
+	Title         string   `json:"title"`
+	Year          int32    `json:"year"`
+	Runtime       int32    `json:"runtime"`
+	Genres        []string `json:"genres"`
+	MediaType     string   `json:"media_type"`
+	EpisodesCount *int32   `json:"episodes_count"`
+	Status        string   `json:"status"`
+}
+
+// The validateAnimeHandler() handler validates the body of a request to create an
+// anime without creating it. If the anime is valid it returns a short-lived commit
+// token, which can be passed to commitAnimeHandler() to create exactly the anime that
+// was validated.
+func (app *application) validateAnimeHandler(w http.ResponseWriter, r *http.Request) {
+	anime, err := app.readAnimeCreate(w, r)
+	if err != nil {
+		app.readAnimeCreateErrorResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateAnime(v, anime); !v.Valid() {
+		app.failedAnimeValidationResponse(w, r, anime, v.Errors)
+		return
+	}
+
+	payload, err := json.Marshal(animeDraft{
+		Title:         anime.Title,
+		Year:          anime.Year,
+		Runtime:       int32(anime.Runtime),
+		Genres:        anime.Genres,
+		MediaType:     anime.MediaType,
+		EpisodesCount: anime.EpisodesCount,
+		Status:        anime.Status,
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	token, err := app.models.Tokens.NewWithPayload(app.dbContext(r), app.contextGetUser(r).ID, app.config.commit.tokenTTL, data.ScopeAnimeCommit, payload)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"commit_token": token}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The commitAnimeHandler() handler creates the anime that a commit token was issued
+// for. The anime isn't validated again. Each token can only be used once, and only by
+// the user it was issued to.
+func (app *application) commitAnimeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	payload, err := app.models.Tokens.Consume(app.dbContext(r), data.ScopeAnimeCommit, input.Token, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired commit token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	var draft animeDraft
+	err = json.Unmarshal(payload, &draft)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.insertAnime(w, r, &data.Anime{
+		Title:         draft.Title,
+		Year:          draft.Year,
+		Runtime:       data.Runtime(draft.Runtime),
+		Genres:        draft.Genres,
+		MediaType:     draft.MediaType,
+		EpisodesCount: draft.EpisodesCount,
+		Status:        draft.Status,
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"greenlight.aida.kz/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCommitAnimeHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		want   string
+	}{
+		{"missing token", `{}`, http.StatusUnprocessableEntity, "must be provided"},
+		{"short token", `{"token": "ABC"}`, http.StatusUnprocessableEntity, "must be 26 bytes long"},
+		{"anime instead of a token", validBatchItem, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := httptest.NewRecorder()
+			app.commitAnimeHandler(rr, app.newRequest(http.MethodPost, "/v1/animes/commit", tt.body, &data.User{ID: 1, Activated: true}))
+
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d; want %d (body: %s)", rr.Code, tt.status, rr.Body)
+			}
+			if tt.want != "" {
+				if got := decodeErrors(t, rr)["token"]; got != tt.want {
+					t.Errorf("errors[token] = %q; want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateAnimeHandlerInvalid(t *testing.T) {
+	app := newTestApplication(t)
+	body := `{"title": "Akira", "year": 1988, "runtime": "124 mins", "genres": ["Sci-Fi"], "media_type": "Movie", "status": "finished", "episodes_count": 0}`
+	rr := httptest.NewRecorder()
+	app.validateAnimeHandler(rr, app.newRequest(http.MethodPost, "/v1/animes/validate", body, &data.User{ID: 1, Activated: true}))
+
+	// An invalid anime doesn't get a commit token.
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d; want %d (body: %s)", rr.Code, http.StatusUnprocessableEntity, rr.Body)
+	}
+	if got := decodeErrors(t, rr)["episodes_count"]; got != "must be at least 1" {
+		t.Errorf("errors[episodes_count] = %q; want %q", got, "must be at least 1")
+	}
+}
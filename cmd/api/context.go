@@ -4,6 +4,7 @@ import (
 	"context"
 	"greenlight.aida.kz/internal/data"
 	"net/http"
+	"time"
 )
 
 type contextKey string
@@ -13,6 +14,22 @@ type contextKey string
 // in the request context.
 const userContextKey = contextKey("user")
 
+// permissionsContextKey is the key for the permissions of the user, once they've been
+// looked up by the requirePermission() middleware.
+const permissionsContextKey = contextKey("permissions")
+
+// requestIDContextKey is the key for the unique ID assigned to each request by the
+// requestID() middleware.
+const requestIDContextKey = contextKey("request_id")
+
+// requestStartContextKey is the key for the time at which the request was received,
+// as recorded by the recordStart() middleware.
+const requestStartContextKey = contextKey("request_start")
+
+// routeContextKey is the key for the *routeInfo which records the pattern of the
+// route that handled the request.
+const routeContextKey = contextKey("route")
+
 // The contextSetUser() method returns a new copy of the request with the provided
 // User struct added to the context. Note that we use our userContextKey constant as the
 // key.
@@ -32,3 +49,84 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// The contextSetPermissions() method returns a new copy of the request with the
+// permissions of the user added to the context.
+func (app *application) contextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+// The contextGetPermissions() method retrieves the user's permissions from the
+// request context. The bool is false if they haven't been looked up yet.
+func (app *application) contextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	permissions, ok := r.Context().Value(permissionsContextKey).(data.Permissions)
+	return permissions, ok
+}
+
+// The contextSetRequestID() method returns a new copy of the request with the
+// provided request ID added to the context.
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// The contextGetRequestID() method retrieves the request ID from the request context.
+// Unlike contextGetUser() this doesn't panic if the value is missing, because error
+// responses can be sent before the requestID() middleware has run. In that case the
+// empty string is returned.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// The requestStart() method returns the time at which the current request was
+// received. If the recordStart() middleware hasn't run (which should only happen in
+// tests of individual handlers) the zero time is returned.
+func (app *application) requestStart(r *http.Request) time.Time {
+	start, _ := r.Context().Value(requestStartContextKey).(time.Time)
+	return start
+}
+
+// routeInfo holds the pattern of the route which matched the request. It is added to
+// the context (empty) by the metrics() middleware before the router runs, and filled
+// in by the route() wrapper, so that the outer middleware can read it once the
+// handler has returned.
+type routeInfo struct {
+	pattern string
+}
+
+// The routePattern() method returns the pattern of the route which handled the
+// request, or "unmatched" if no route matched.
+func (app *application) routePattern(r *http.Request) string {
+	info, ok := r.Context().Value(routeContextKey).(*routeInfo)
+	if !ok || info.pattern == "" {
+		return "unmatched"
+	}
+	return info.pattern
+}
+
+// The dbContext() method returns the request context carrying the request ID in the
+// form the data package traces database transactions with.
+func (app *application) dbContext(r *http.Request) context.Context {
+	return data.WithRequestID(r.Context(), app.contextGetRequestID(r))
+}
+
+// detachedContext carries the values of its parent context, but not its deadline or
+// cancellation.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (c detachedContext) Value(key any) any         { return c.parent.Value(key) }
+
+// The detach() helper returns a context with the values of ctx (such as the request ID
+// and query counter) which isn't canceled along with it. It's for database writes
+// which must complete even if the client has gone away, such as audit log entries for
+// changes which have already been made.
+func detach(ctx context.Context) context.Context {
+	return detachedContext{parent: ctx}
+}
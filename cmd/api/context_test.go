@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRecordStart(t *testing.T) {
+	app := newTestApplication(t)
+
+	before := time.Now()
+	var start time.Time
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start = app.requestStart(r)
+	})
+	app.recordStart(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if start.Before(before) || start.After(time.Now()) {
+		t.Errorf("requestStart() = %v; want a time during the request", start)
+	}
+}
+
+func TestRequestStartWithoutMiddleware(t *testing.T) {
+	app := newTestApplication(t)
+
+	if start := app.requestStart(httptest.NewRequest(http.MethodGet, "/", nil)); !start.IsZero() {
+		t.Errorf("requestStart() = %v; want the zero time", start)
+	}
+}
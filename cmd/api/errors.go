@@ -1,20 +1,60 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"greenlight.aida.kz/internal/data"
+	"greenlight.aida.kz/internal/i18n"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *application) logError(r *http.Request, err error) {
-	app.logger.PrintError(err, map[string]string{
+	properties := map[string]string{
+		"request_id":     app.contextGetRequestID(r),
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
-	})
+	}
+	if start := app.requestStart(r); !start.IsZero() {
+		properties["request_elapsed"] = time.Since(start).String()
+	}
+	app.logger.PrintError(err, properties)
 }
 
+// The errorResponse() method sends a JSON-formatted error message to the client. The
+// message can either be a single string or a map of validation errors, and in both
+// cases the text is translated into the language requested in the Accept-Language
+// header (if we support it).
 func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
-	env := envelope{"error": message}
-	err := app.writeJSON(w, status, env, nil)
+	app.errorResponseWith(w, r, status, message, nil)
+}
+
+// The errorResponseWith() method is like errorResponse(), but also writes the fields
+// in extra alongside the error message.
+func (app *application) errorResponseWith(w http.ResponseWriter, r *http.Request, status int, message any, extra envelope) {
+	lang := i18n.MatchLanguage(r.Header.Get("Accept-Language"))
+	switch m := message.(type) {
+	case string:
+		message = i18n.Translate(lang, m)
+	case map[string]string:
+		translated := make(map[string]string, len(m))
+		for key, value := range m {
+			translated[key] = i18n.Translate(lang, value)
+		}
+		message = translated
+	}
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+
+	// Both single messages and maps of messages are written under the same key, which
+	// can be changed with the -error-key flag.
+	env := envelope{app.config.errorKey: message}
+	for key, value := range extra {
+		env[key] = value
+	}
+	err := app.writeJSON(w, r, status, env, nil)
 	if err != nil {
 		app.logError(r, err)
 		w.WriteHeader(500)
@@ -23,6 +63,12 @@ func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, st
 
 func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logError(r, err)
+	// If no database connection could be acquired in time the server is overloaded
+	// rather than broken, so tell the client to back off and try again.
+	if errors.Is(err, data.ErrPoolExhausted) {
+		app.serviceUnavailableResponse(w, r, 0)
+		return
+	}
 	message := "the server encountered a problem and could not process your request"
 	app.errorResponse(w, r, http.StatusInternalServerError, message)
 }
@@ -41,6 +87,18 @@ func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.
 	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
 }
 
+// The readJSONErrorResponse() method sends the appropriate response for an error
+// returned by readJSONWithSchema(): a 422 listing the schema violations, or a 400 for
+// anything else.
+func (app *application) readJSONErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var se *schemaError
+	if errors.As(err, &se) {
+		app.failedValidationResponse(w, r, se.errors)
+		return
+	}
+	app.badRequestResponse(w, r, err)
+}
+
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update the record due to an edit conflict, please try again"
 	app.errorResponse(w, r, http.StatusConflict, message)
@@ -51,6 +109,25 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	app.errorResponse(w, r, http.StatusTooManyRequests, message)
 }
 
+func (app *application) ratingThrottledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you have changed your rating of this anime too many times, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
+
+// The notAcceptableResponse() method sends a 406 Not Acceptable response which lists
+// the media types the route can respond with. It's always written as JSON, since
+// there's nothing else the client could have asked for that we could send.
+func (app *application) notAcceptableResponse(w http.ResponseWriter, r *http.Request, supported []string) {
+	w.Header().Add("Vary", "Accept")
+	message := "the requested resource is not available in a format accepted by the Accept header"
+	app.errorResponseWith(w, r, http.StatusNotAcceptable, message, envelope{"supported_types": supported})
+}
+
+func (app *application) headersTooLargeResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the request contains too many header fields"
+	app.errorResponse(w, r, http.StatusRequestHeaderFieldsTooLarge, message)
+}
+
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
 	app.errorResponse(w, r, http.StatusUnauthorized, message)
@@ -71,7 +148,41 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
 
+func (app *application) suspendedAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account has been suspended"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) registrationDisabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "user registration is disabled on this server"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+// The setRetryAfter() method sets the Retry-After header to retryAfter, rounded up to
+// a whole number of seconds. If retryAfter is zero or negative the configured default
+// is used.
+func (app *application) setRetryAfter(w http.ResponseWriter, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		retryAfter = app.config.retryAfter
+	}
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// The serviceUnavailableResponse() method sends a 503 Service Unavailable response
+// with a Retry-After header, so that clients back off consistently whichever part of
+// the application is shedding load. If retryAfter is zero or negative the configured
+// default is used.
+func (app *application) serviceUnavailableResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	app.setRetryAfter(w, retryAfter)
+	message := "the server is temporarily unable to handle your request, please try again later"
+	app.errorResponse(w, r, http.StatusServiceUnavailable, message)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"greenlight.aida.kz/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServiceUnavailableResponse(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.retryAfter = 30 * time.Second
+
+	tests := []struct {
+		retryAfter time.Duration
+		want       string
+	}{
+		{0, "30"},
+		{-time.Second, "30"},
+		{5 * time.Second, "5"},
+		{1500 * time.Millisecond, "2"},
+		{time.Millisecond, "1"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		app.serviceUnavailableResponse(rr, httptest.NewRequest(http.MethodGet, "/", nil), tt.retryAfter)
+
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("retryAfter %v: status = %d; want %d", tt.retryAfter, rr.Code, http.StatusServiceUnavailable)
+		}
+		if got := rr.Header().Get("Retry-After"); got != tt.want {
+			t.Errorf("retryAfter %v: Retry-After = %q; want %q", tt.retryAfter, got, tt.want)
+		}
+	}
+}
+
+func TestErrorResponseLanguage(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		acceptLanguage string
+		wantLanguage   string
+		wantMessage    string
+	}{
+		{"", "en", "the requested resource could not be found"},
+		{"ru-RU,ru;q=0.9", "ru", "запрошенный ресурс не найден"},
+		{"fr", "en", "the requested resource could not be found"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Language", tt.acceptLanguage)
+		rr := httptest.NewRecorder()
+		app.notFoundResponse(rr, r)
+
+		if got := rr.Header().Get("Content-Language"); got != tt.wantLanguage {
+			t.Errorf("%q: Content-Language = %q; want %q", tt.acceptLanguage, got, tt.wantLanguage)
+		}
+		if got := rr.Header().Get("Vary"); got != "Accept-Language" {
+			t.Errorf("%q: Vary = %q; want Accept-Language", tt.acceptLanguage, got)
+		}
+		var body struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Error != tt.wantMessage {
+			t.Errorf("%q: error = %q; want %q", tt.acceptLanguage, body.Error, tt.wantMessage)
+		}
+	}
+}
+
+func TestFailedValidationResponseLanguage(t *testing.T) {
+	app := newTestApplication(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "ru")
+	rr := httptest.NewRecorder()
+	app.failedValidationResponse(rr, r, map[string]string{"email": "must be provided", "title": "untranslated"})
+
+	errs := decodeErrors(t, rr)
+	if errs["email"] != "обязательное поле" {
+		t.Errorf("errors[email] = %q; want the Russian translation", errs["email"])
+	}
+	if errs["title"] != "untranslated" {
+		t.Errorf("errors[title] = %q; want it unchanged", errs["title"])
+	}
+}
+
+func TestServerErrorResponsePoolExhausted(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.retryAfter = 2 * time.Second
+
+	rr := httptest.NewRecorder()
+	app.serverErrorResponse(rr, httptest.NewRequest(http.MethodGet, "/", nil), fmt.Errorf("listing animes: %w", data.ErrPoolExhausted))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d; want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q; want %q", got, "2")
+	}
+
+	rr = httptest.NewRecorder()
+	app.serverErrorResponse(rr, httptest.NewRequest(http.MethodGet, "/", nil), errors.New("boom"))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d; want %d", rr.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestErrorResponseKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		respond func(app *application, w http.ResponseWriter, r *http.Request)
+		want    string
+	}{
+		{
+			name:    "generic error",
+			key:     "errors",
+			respond: func(app *application, w http.ResponseWriter, r *http.Request) { app.notFoundResponse(w, r) },
+			want:    `{"errors":"the requested resource could not be found"}`,
+		},
+		{
+			name: "validation errors",
+			key:  "errors",
+			respond: func(app *application, w http.ResponseWriter, r *http.Request) {
+				app.failedValidationResponse(w, r, map[string]string{"title": "must be provided"})
+			},
+			want: `{"errors":{"title":"must be provided"}}`,
+		},
+		{
+			name:    "default key",
+			key:     "error",
+			respond: func(app *application, w http.ResponseWriter, r *http.Request) { app.notFoundResponse(w, r) },
+			want:    `{"error":"the requested resource could not be found"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.errorKey = tt.key
+			rr := httptest.NewRecorder()
+			tt.respond(app, rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			var got, want any
+			if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("body = %s; want %s", rr.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestRatingThrottledResponse(t *testing.T) {
+	app := newTestApplication(t)
+	rr := httptest.NewRecorder()
+	app.ratingThrottledResponse(rr, httptest.NewRequest(http.MethodPut, "/v1/animes/1/rating", nil))
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d; want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if want := "you have changed your rating of this anime too many times, please try again later"; body.Error != want {
+		t.Errorf("error = %q; want %q", body.Error, want)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"greenlight.aida.kz/internal/data"
+	"greenlight.aida.kz/internal/validator"
+	"io"
+	"net/http"
+)
+
+func (app *application) exportAnimesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	format := app.readString(qs, "format", "jsonl")
+	compress := app.readBool(qs, "gzip", false, v)
+
+	v.Check(validator.PermittedValue(format, "jsonl"), "format", "must be jsonl")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	release, ok := app.acquireStream()
+	if !ok {
+		app.serviceUnavailableResponse(w, r, 0)
+		return
+	}
+	defer release()
+
+	// A compressed export is served as a gzip file rather than with Content-Encoding,
+	// so that clients which transparently decode the body don't save plain NDJSON
+	// under a .gz filename.
+	filename := "animes.jsonl"
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if compress {
+		filename += ".gz"
+		w.Header().Set("Content-Type", "application/gzip")
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	var out io.Writer = w
+	if compress {
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+	}
+
+	// Each anime is written as a single line of JSON as soon as it has been read from
+	// the database. Once the response headers have been sent we can no longer send an
+	// error response, so any errors from here on are just logged.
+	enc := json.NewEncoder(out)
+	err := app.models.Animes.StreamAll(app.dbContext(r), func(anime *data.Anime) error {
+		return enc.Encode(anime)
+	})
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+func (app *application) exportAnimeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	format := app.readString(r.URL.Query(), "format", "json")
+	s, ok := serializers[format]
+	v.Check(ok, "format", "must be json, yaml or csv")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	anime, err := app.models.Animes.Get(app.dbContext(r), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Encode into a buffer first, so that we can still send an error response if
+	// something goes wrong.
+	var buf bytes.Buffer
+	err = s.encode(&buf, anime)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", s.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="anime-%d.%s"`, anime.ID, s.extension))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
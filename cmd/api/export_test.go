@@ -0,0 +1,65 @@
+package main
+
+import (
+	"greenlight.aida.kz/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExportAnimesHandlerValidation(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		query string
+		key   string
+	}{
+		{"?format=csv", "format"},
+		{"?gzip=maybe", "gzip"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		app.exportAnimesHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/animes/export"+tt.query, nil))
+
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("%s: status = %d; want %d", tt.query, rr.Code, http.StatusUnprocessableEntity)
+		}
+		if errs := decodeErrors(t, rr); errs[tt.key] == "" {
+			t.Errorf("%s: errors = %v; want an error for %q", tt.query, errs, tt.key)
+		}
+	}
+}
+
+func TestStreamsAtLimit(t *testing.T) {
+	handlers := map[string]func(app *application, w http.ResponseWriter){
+		"export": func(app *application, w http.ResponseWriter) {
+			app.exportAnimesHandler(w, httptest.NewRequest(http.MethodGet, "/v1/animes/export", nil))
+		},
+		"list": func(app *application, w http.ResponseWriter) {
+			r := app.newRequest(http.MethodGet, "/v1/animes", "", &data.User{ID: 1, Activated: true})
+			r.Header.Set("Accept", "application/x-ndjson")
+			app.listAnimesHandler(w, app.contextSetPermissions(r, data.Permissions{"animes:read"}))
+		},
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.retryAfter = 5 * time.Second
+			app.streams = make(chan struct{}, 1)
+			app.streams <- struct{}{}
+			rr := httptest.NewRecorder()
+			handler(app, rr)
+
+			if rr.Code != http.StatusServiceUnavailable {
+				t.Errorf("status = %d; want %d", rr.Code, http.StatusServiceUnavailable)
+			}
+			if got := rr.Header().Get("Retry-After"); got != "5" {
+				t.Errorf("Retry-After = %q; want 5", got)
+			}
+			if got := rr.Header().Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q; want application/json", got)
+			}
+		})
+	}
+}
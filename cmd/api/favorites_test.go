@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"greenlight.aida.kz/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFavoritesRequireActivatedUser(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+	}{
+		{http.MethodPost, "/v1/animes/1/favorite"},
+		{http.MethodDelete, "/v1/animes/1/favorite"},
+		{http.MethodGet, "/v1/users/me/favorites"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := app.serveTest(t, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d; want %d", rr.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestFavoriteHandlersInvalidID(t *testing.T) {
+	handlers := map[string]func(*application) http.HandlerFunc{
+		"add":    func(app *application) http.HandlerFunc { return app.addFavoriteHandler },
+		"remove": func(app *application) http.HandlerFunc { return app.removeFavoriteHandler },
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			app := newTestApplication(t)
+			r := app.newRequest(http.MethodPost, "/v1/animes/0/favorite", "", &data.User{ID: 1, Activated: true})
+			r = withParams(r, httprouter.Params{{Key: "id", Value: "0"}})
+			rr := httptest.NewRecorder()
+			handler(app).ServeHTTP(rr, r)
+
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("status = %d; want %d", rr.Code, http.StatusNotFound)
+			}
+		})
+	}
+}
+
+func TestListFavoritesHandlerValidation(t *testing.T) {
+	tests := []struct {
+		query string
+		key   string
+	}{
+		{"sort=title", "sort"},
+		{"page=0", "page"},
+		{"page_size=101", "page_size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			app := newTestApplication(t)
+			r := app.newRequest(http.MethodGet, "/v1/users/me/favorites?"+tt.query, "", &data.User{ID: 1, Activated: true})
+			rr := httptest.NewRecorder()
+			app.listFavoritesHandler(rr, r)
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+			}
+			if _, ok := decodeErrors(t, rr)[tt.key]; !ok {
+				t.Errorf("no error for %q", tt.key)
+			}
+		})
+	}
+}
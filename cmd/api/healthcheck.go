@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 )
 
 func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Request) {
@@ -13,9 +17,104 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		},
 	}
 
-	err := app.writeJSON(w, http.StatusOK, env, nil)
+	err := app.writeJSON(w, r, http.StatusOK, env, nil)
 	if err != nil {
 		app.logger.PrintFatal(err, nil)
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// parseRootLinks parses a comma-separated list of name=URL pairs, such as
+// "openapi=/docs/openapi.json", into the links described by the root endpoint.
+func parseRootLinks(s string) (map[string]string, error) {
+	links := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return links, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		name, url, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		url = strings.TrimSpace(url)
+		if !ok || name == "" || url == "" {
+			return nil, errors.New("root links must be in the format name=URL")
+		}
+		links[name] = url
+	}
+	return links, nil
+}
+
+// The rootHandler() method describes the API for anyone making a request to "/",
+// rather than sending them a 404. The name and any extra links come from -root-name
+// and -root-links.
+func (app *application) rootHandler(w http.ResponseWriter, r *http.Request) {
+	links := map[string]string{
+		"healthcheck": "/v1/healthcheck",
+	}
+	for name, url := range app.config.root.links {
+		links[name] = url
+	}
+	env := envelope{
+		"name":    app.config.root.name,
+		"version": version,
+		"links":   links,
+	}
+
+	err := app.writeJSON(w, r, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The readyzHandler() method reports whether the application is ready to handle
+// traffic, so that load balancers can stop sending it requests. It responds with 503
+// Service Unavailable if the database can't be reached, or if the connection pool has
+// been saturated (see poolSaturated) for long enough that queries are likely to start
+// timing out.
+func (app *application) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+
+	status, code := "ready", http.StatusOK
+	saturation := app.db.Saturation()
+	switch {
+	case app.db.Ping(ctx) != nil:
+		status, code = "unavailable", http.StatusServiceUnavailable
+	case app.poolSaturated(saturation, time.Now()):
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+
+	stat := app.db.Stat()
+	env := envelope{
+		"status": status,
+		"database": map[string]any{
+			"acquired_conns": stat.AcquiredConns(),
+			"max_conns":      stat.MaxConns(),
+			"saturation":     saturation,
+		},
+	}
+	// The pool figures are kept in the body of a 503, so it isn't sent with
+	// serviceUnavailableResponse(), but it gets the same Retry-After header.
+	if code == http.StatusServiceUnavailable {
+		app.setRetryAfter(w, 0)
+	}
+	err := app.writeJSON(w, r, code, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// The poolSaturated() helper records whether the given pool saturation is above the
+// -readyz-saturation-percent, and reports whether it has been above it for at least
+// the -readyz-saturation-period. The saturation is only sampled when /readyz is
+// requested, so a dip between two probes isn't noticed; probes should be made more
+// often than the period.
+func (app *application) poolSaturated(saturation float64, now time.Time) bool {
+	threshold := app.config.readiness.saturationPercent
+	if threshold <= 0 || saturation*100 <= threshold {
+		app.saturatedSince.Store(0)
+		return false
+	}
+	app.saturatedSince.CompareAndSwap(0, now.UnixNano())
+	since := app.saturatedSince.Load()
+	return since != 0 && now.Sub(time.Unix(0, since)) >= app.config.readiness.saturationPeriod
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRootHandler(t *testing.T) {
+	app := newTestApplication(t)
+	rr := app.serveTest(t, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", rr.Code, http.StatusOK)
+	}
+	var got struct {
+		Name    string            `json:"name"`
+		Version string            `json:"version"`
+		Links   map[string]string `json:"links"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "greenlight" {
+		t.Errorf("name = %q; want %q", got.Name, "greenlight")
+	}
+	if got.Version != version {
+		t.Errorf("version = %q; want %q", got.Version, version)
+	}
+	if got.Links["healthcheck"] != "/v1/healthcheck" {
+		t.Errorf("links = %v; want a healthcheck link", got.Links)
+	}
+}
+
+func TestRootHandlerConfigured(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.root.name = "anime-catalog"
+	app.config.root.links = map[string]string{"openapi": "/docs/openapi.json"}
+	rr := app.serveTest(t, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var got struct {
+		Name  string            `json:"name"`
+		Links map[string]string `json:"links"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "anime-catalog" {
+		t.Errorf("name = %q; want %q", got.Name, "anime-catalog")
+	}
+	want := map[string]string{"healthcheck": "/v1/healthcheck", "openapi": "/docs/openapi.json"}
+	if !reflect.DeepEqual(got.Links, want) {
+		t.Errorf("links = %v; want %v", got.Links, want)
+	}
+}
+
+func TestParseRootLinks(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"openapi=/docs/openapi.json", map[string]string{"openapi": "/docs/openapi.json"}, false},
+		{" openapi = https://example.com/openapi.json?v=2 , docs=/docs ", map[string]string{"openapi": "https://example.com/openapi.json?v=2", "docs": "/docs"}, false},
+		{"openapi", nil, true},
+		{"=/docs", nil, true},
+	}
+	for _, tt := range tests {
+		links, err := parseRootLinks(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRootLinks(%q): err = %v; want error: %t", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(links, tt.want) {
+			t.Errorf("parseRootLinks(%q) = %v; want %v", tt.input, links, tt.want)
+		}
+	}
+}
+
+func TestPoolSaturated(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.readiness.saturationPercent = 90
+	app.config.readiness.saturationPeriod = 30 * time.Second
+	start := time.Now()
+
+	// Each sample is taken by a probe at the given offset from start.
+	samples := []struct {
+		offset     time.Duration
+		saturation float64
+		want       bool
+	}{
+		{0, 0.5, false},
+		{10 * time.Second, 0.95, false},
+		{30 * time.Second, 1, false},
+		{40 * time.Second, 0.95, true},
+		{50 * time.Second, 0.9, false},
+		{60 * time.Second, 1, false},
+		{95 * time.Second, 1, true},
+	}
+	for _, s := range samples {
+		if got := app.poolSaturated(s.saturation, start.Add(s.offset)); got != s.want {
+			t.Errorf("at %v with saturation %v: poolSaturated() = %t; want %t", s.offset, s.saturation, got, s.want)
+		}
+	}
+}
+
+func TestPoolSaturatedDisabled(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.readiness.saturationPercent = 0
+	now := time.Now()
+
+	app.poolSaturated(1, now)
+	if app.poolSaturated(1, now.Add(time.Hour)) {
+		t.Error("poolSaturated() = true with the threshold disabled")
+	}
+}
+
+func TestReadyzHandlerUnavailable(t *testing.T) {
+	app := newTestApplication(t)
+	app.db = newRefusingDB(t)
+	app.config.retryAfter = 30 * time.Second
+	rr := app.serveTest(t, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d; want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q; want 30", got)
+	}
+	if got := rr.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q; want no-store", got)
+	}
+	var got struct {
+		Status   string `json:"status"`
+		Database struct {
+			AcquiredConns int32   `json:"acquired_conns"`
+			MaxConns      int32   `json:"max_conns"`
+			Saturation    float64 `json:"saturation"`
+		} `json:"database"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "unavailable" {
+		t.Errorf("status = %q; want %q", got.Status, "unavailable")
+	}
+	if got.Database.MaxConns == 0 {
+		t.Errorf("database = %+v; want the pool figures", got.Database)
+	}
+}
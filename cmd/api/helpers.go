@@ -1,30 +1,63 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
+	"greenlight.aida.kz/internal/data"
 	"greenlight.aida.kz/internal/validator"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type envelope map[string]any
 
+var errInvalidIDParam = errors.New("invalid id parameter")
+
+// The readIDParam() helper reads the "id" URL parameter from the current request
+// context. Only plain decimal digits are accepted, so values such as "+1" or " 1" are
+// rejected, as are zero, negative numbers and anything which overflows an int64. In
+// all of these cases errInvalidIDParam is returned.
 func (app *application) readIDParam(r *http.Request) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	s := params.ByName("id")
+	if s == "" {
+		return 0, errInvalidIDParam
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return 0, errInvalidIDParam
+		}
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, errInvalidIDParam
 	}
 	return id, nil
 }
 
-func (app *application) writeJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
+// The writeJSON() helper sends a JSON response. Unless meta is disabled in the
+// configuration or by the client with ?meta=false, a "meta" object containing the
+// request ID and the current server time is added to the envelope.
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	if _, exists := data["meta"]; !exists && app.includeMeta(r) {
+		withMeta := make(envelope, len(data)+1)
+		for key, value := range data {
+			withMeta[key] = value
+		}
+		withMeta["meta"] = map[string]string{
+			"request_id":  app.contextGetRequestID(r),
+			"server_time": app.formatTime(time.Now()),
+		}
+		data = withMeta
+	}
+
 	js, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
 		return err
@@ -40,9 +73,66 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	return nil
 }
 
+// includeMeta reports whether the meta object should be added to the response for
+// the current request.
+func (app *application) includeMeta(r *http.Request) bool {
+	if !app.config.responseMeta {
+		return false
+	}
+	include, err := strconv.ParseBool(r.URL.Query().Get("meta"))
+	return err != nil || include
+}
+
+// schemaError is returned by readJSONWithSchema() when the request body doesn't
+// conform to the schema. It holds the validation errors keyed by path, and the
+// decoded body.
+type schemaError struct {
+	errors map[string]string
+	doc    any
+}
+
+func (e *schemaError) Error() string {
+	return "body does not match the schema"
+}
+
+// The readJSONWithSchema() helper validates the request body against the named JSON
+// Schema before decoding it into dst with readJSON(). If the body is well-formed
+// JSON but doesn't conform to the schema a *schemaError is returned. Badly-formed
+// bodies are left for readJSON() to report in the usual way.
+func (app *application) readJSONWithSchema(w http.ResponseWriter, r *http.Request, dst any, schemaName string) error {
+	schema, ok := app.schemas[schemaName]
+	if !ok {
+		panic("unknown schema: " + schemaName)
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		}
+		return err
+	}
+	var doc any
+	if json.Unmarshal(body, &doc) == nil {
+		if errs := schema.Validate(doc); len(errs) > 0 {
+			return &schemaError{errors: errs, doc: doc}
+		}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return app.readJSON(w, r, dst)
+}
+
+// maxBodyBytes is the maximum size of a JSON request body.
+const maxBodyBytes = 1_048_576
+
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst any) error {
-	maxBytes := 1_048_576
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+	return app.readJSONLimit(w, r, dst, maxBodyBytes)
+}
+
+// The readJSONLimit() helper is like readJSON(), but allows the body to be up to
+// maxBytes long. It's used by endpoints which accept larger bodies, such as batches.
+func (app *application) readJSONLimit(w http.ResponseWriter, r *http.Request, dst any, maxBytes int64) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
 
@@ -118,6 +208,67 @@ func (app *application) readCSV(qs url.Values, key string, defaultValue []string
 	return strings.Split(csv, ",")
 }
 
+// maxIDList is the maximum number of IDs accepted by readIDList() and readBulkIDs().
+const maxIDList = 100
+
+// The readIDList() helper reads a comma-separated list of record IDs from the query
+// string, dropping any repeated IDs. Invalid IDs, or more than maxIDList of them, are
+// recorded as errors in the validator instance.
+func (app *application) readIDList(qs url.Values, key string, v *validator.Validator) []int64 {
+	values := app.readCSV(qs, key, nil)
+	ids := make([]int64, 0, len(values))
+	for _, value := range values {
+		id, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			v.AddError(key, "must only contain positive integer IDs")
+			return nil
+		}
+		ids = append(ids, id)
+	}
+	return checkIDList(key, ids, v)
+}
+
+// The readBulkIDs() helper reads the "ids" list for a bulk lookup. A GET request
+// gives the IDs in the query string, and a POST request gives them as a JSON array
+// in the body, for lists which are too long to fit in a URL. An error is only
+// returned if the body couldn't be decoded; invalid IDs are recorded in the
+// validator instance, as for readIDList().
+func (app *application) readBulkIDs(w http.ResponseWriter, r *http.Request, v *validator.Validator) ([]int64, error) {
+	if r.Method != http.MethodPost {
+		return app.readIDList(r.URL.Query(), "ids", v), nil
+	}
+	var input struct {
+		IDs data.IDs `json:"ids"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		return nil, err
+	}
+	return checkIDList("ids", input.IDs.Int64s(), v), nil
+}
+
+// checkIDList drops any repeated IDs from a list, and records an error in the
+// validator instance if the list holds an ID below 1 or more than maxIDList IDs.
+func checkIDList(key string, ids []int64, v *validator.Validator) []int64 {
+	if len(ids) > maxIDList {
+		v.AddError(key, fmt.Sprintf("must not contain more than %d IDs", maxIDList))
+		return nil
+	}
+	unique := make([]int64, 0, len(ids))
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if id < 1 {
+			v.AddError(key, "must only contain positive integer IDs")
+			return nil
+		}
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
 func (app *application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
 	// Extract the value from the query string.
 	s := qs.Get(key)
@@ -136,6 +287,183 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+// The presentAnime() helper returns the value that should be written to the response
+// for an anime. If the client sent ?nulls=explicit then the omitempty fields are
+// always included, using null for zero values. Otherwise a zero runtime is only
+// included (as null) if strict runtime mode is enabled. If the client sent
+// ?links=true a _links object is added, with the actions the user is allowed to take.
+func (app *application) presentAnime(r *http.Request, anime *data.Anime) any {
+	var permissions data.Permissions
+	if wantLinks(r) {
+		permissions = app.requestPermissions(r)
+	}
+	return app.present(r, anime, permissions)
+}
+
+// The presentAnimes() helper applies presentAnime() to every anime in a slice,
+// looking up the user's permissions only once.
+func (app *application) presentAnimes(r *http.Request, animes []*data.Anime) []any {
+	var permissions data.Permissions
+	if wantLinks(r) {
+		permissions = app.requestPermissions(r)
+	}
+	presented := make([]any, len(animes))
+	for i, anime := range animes {
+		presented[i] = app.present(r, anime, permissions)
+	}
+	return presented
+}
+
+func (app *application) present(r *http.Request, anime *data.Anime, permissions data.Permissions) any {
+	var presented any
+	if r.URL.Query().Get("nulls") == "explicit" {
+		presented = anime.ExplicitNulls()
+	} else {
+		presented = anime.WithStrictRuntime()
+	}
+	if !wantLinks(r) {
+		return presented
+	}
+	return withLinks{resource: presented, links: animeLinks(anime.ID, permissions)}
+}
+
+// The readBool() helper reads a boolean value from the query string. If no matching
+// key could be found it returns the provided default value, and if the value couldn't
+// be parsed it records an error in the validator instance.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+// The acceptsMediaType() helper reports whether the request's Accept header
+// explicitly lists the given media type. Wildcards aren't taken into account.
+func acceptsMediaType(r *http.Request, mediaType string) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		accepted, _, _ = strings.Cut(accepted, ";")
+		if strings.EqualFold(strings.TrimSpace(accepted), mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeSupportedTypes returns the media types that the route with the given pattern
+// can respond with.
+func routeSupportedTypes(pattern string) []string {
+	if types, ok := routeMediaTypes[pattern]; ok {
+		return types
+	}
+	return []string{"application/json"}
+}
+
+// The acceptable() helper reports whether the request's Accept header allows at least
+// one of the media types supported by the route. A missing Accept header, or one with
+// a matching wildcard such as */* or application/*, allows anything. Ranges with a
+// quality of 0 are treated as excluded. When -strict-accept is off every request is
+// acceptable and JSON is sent regardless.
+func (app *application) acceptable(r *http.Request, pattern string) bool {
+	if !app.config.accept.strict {
+		return true
+	}
+	header := strings.TrimSpace(r.Header.Get("Accept"))
+	if header == "" {
+		return true
+	}
+	supported := routeSupportedTypes(pattern)
+	for _, accepted := range strings.Split(header, ",") {
+		mediaRange, params, _ := strings.Cut(accepted, ";")
+		mediaRange = strings.ToLower(strings.TrimSpace(mediaRange))
+		if excludedByQuality(params) {
+			continue
+		}
+		if mediaRange == "*/*" {
+			return true
+		}
+		for _, mediaType := range supported {
+			if mediaRange == mediaType {
+				return true
+			}
+			if strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// excludedByQuality reports whether the parameters of an Accept media range give it a
+// quality value of zero.
+func excludedByQuality(params string) bool {
+	for _, param := range strings.Split(params, ";") {
+		key, value, _ := strings.Cut(param, "=")
+		if strings.EqualFold(strings.TrimSpace(key), "q") {
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			return err == nil && q == 0
+		}
+	}
+	return false
+}
+
+// The staticOrID() helper returns a handler for a route ending in an :id parameter
+// which dispatches fixed path segments (like "export") to their own handlers.
+// httprouter doesn't allow a static segment and a wildcard to share the same position
+// in a route, so this is how we register endpoints such as /v1/animes/export
+// alongside /v1/animes/:id.
+func (app *application) staticOrID(static map[string]http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		if handler, ok := static[params.ByName("id")]; ok {
+			handler(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// The formatTime() helper formats a timestamp for a response in the configured time
+// zone.
+func (app *application) formatTime(t time.Time) string {
+	return t.In(app.location()).Format(time.RFC3339)
+}
+
+// location returns the configured time zone, falling back to UTC.
+func (app *application) location() *time.Location {
+	if app.config.location == nil {
+		return time.UTC
+	}
+	return app.config.location
+}
+
+// The readDate() helper reads a date-only value in the format YYYY-MM-DD from the
+// query string, interpreted in the configured time zone. If endOfDay is true the
+// last instant of that day is returned, otherwise the first, so that the value can be
+// used directly as an inclusive upper or lower bound. If no matching key could be
+// found it returns the zero time, and if the value couldn't be parsed it records an
+// error in the validator instance.
+func (app *application) readDate(qs url.Values, key string, endOfDay bool, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, app.location())
+	if err != nil {
+		v.AddError(key, "must be a date in the format YYYY-MM-DD")
+		return time.Time{}
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t
+}
+
 func (app *application) background(fn func()) {
 	// Increment the WaitGroup counter.
 	app.wg.Add(1)
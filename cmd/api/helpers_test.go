@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/julienschmidt/httprouter"
+	"greenlight.aida.kz/internal/validator"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withParams returns a copy of r carrying the given httprouter parameters, as though
+// it had been routed to a handler by the router.
+func withParams(r *http.Request, params httprouter.Params) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+}
+
+func TestReadIDParam(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		param string
+		want  int64
+		err   error
+	}{
+		{"1", 1, nil},
+		{"42", 42, nil},
+		{"9223372036854775807", 9223372036854775807, nil},
+		{"9223372036854775808", 0, errInvalidIDParam},
+		{"99999999999999999999999", 0, errInvalidIDParam},
+		{"0", 0, errInvalidIDParam},
+		{"-1", 0, errInvalidIDParam},
+		{"+1", 0, errInvalidIDParam},
+		{" 1", 0, errInvalidIDParam},
+		{"1e3", 0, errInvalidIDParam},
+		{"0x10", 0, errInvalidIDParam},
+		{"abc", 0, errInvalidIDParam},
+		{"", 0, errInvalidIDParam},
+	}
+	for _, tt := range tests {
+		r := withParams(httptest.NewRequest(http.MethodGet, "/", nil), httprouter.Params{{Key: "id", Value: tt.param}})
+		got, err := app.readIDParam(r)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("readIDParam(%q) = %d, %v; want %d, %v", tt.param, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestReadIDList(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		query string
+		want  []int64
+		valid bool
+	}{
+		{"", []int64{}, true},
+		{"ids=1,2,3", []int64{1, 2, 3}, true},
+		{"ids=3,1,3, 2", []int64{3, 1, 2}, true},
+		{"ids=1,abc", nil, false},
+		{"ids=1,0", nil, false},
+		{"ids=-1", nil, false},
+		{"ids=99999999999999999999", nil, false},
+		{"ids=" + strings.Repeat("1,", maxIDList) + "1", nil, false},
+	}
+	for _, tt := range tests {
+		qs, _ := url.ParseQuery(tt.query)
+		v := validator.New()
+		got := app.readIDList(qs, "ids", v)
+		if v.Valid() != tt.valid {
+			t.Errorf("readIDList(%q): valid = %t; want %t (errors: %v)", tt.query, v.Valid(), tt.valid, v.Errors)
+		}
+		if tt.valid && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("readIDList(%q) = %v; want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestReadBulkIDs(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		want    []int64
+		valid   bool
+		wantErr bool
+	}{
+		{"query string", http.MethodGet, "/?ids=1,2", "", []int64{1, 2}, true, false},
+		{"body", http.MethodPost, "/", `{"ids": [2, 1, 2]}`, []int64{2, 1}, true, false},
+		{"string in body", http.MethodPost, "/", `{"ids": [1, "2"]}`, nil, true, true},
+		{"zero in body", http.MethodPost, "/", `{"ids": [0]}`, nil, false, false},
+		{"unknown key", http.MethodPost, "/", `{"id": [1]}`, nil, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			v := validator.New()
+			got, err := app.readBulkIDs(httptest.NewRecorder(), r, v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v; want error: %t", err, tt.wantErr)
+			}
+			if v.Valid() != tt.valid {
+				t.Errorf("valid = %t; want %t (errors: %v)", v.Valid(), tt.valid, v.Errors)
+			}
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ids = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteJSONMeta(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		query   string
+		want    bool
+	}{
+		{"enabled", true, "", true},
+		{"enabled, opted out", true, "?meta=false", false},
+		{"enabled, invalid value", true, "?meta=maybe", true},
+		{"disabled", false, "", false},
+		{"disabled, opted in", false, "?meta=true", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.responseMeta = tt.enabled
+
+			r := app.contextSetRequestID(httptest.NewRequest(http.MethodGet, "/"+tt.query, nil), "abc-123")
+			rr := httptest.NewRecorder()
+			if err := app.writeJSON(rr, r, http.StatusOK, envelope{"status": "ok"}, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			var body struct {
+				Status string             `json:"status"`
+				Meta   *map[string]string `json:"meta"`
+			}
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Status != "ok" {
+				t.Errorf("status = %q; want %q", body.Status, "ok")
+			}
+			if (body.Meta != nil) != tt.want {
+				t.Fatalf("meta included = %t; want %t", body.Meta != nil, tt.want)
+			}
+			if tt.want {
+				meta := *body.Meta
+				if meta["request_id"] != "abc-123" || meta["server_time"] == "" {
+					t.Errorf("meta = %v; want the request ID and server time", meta)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteJSONKeepsExistingMeta(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.responseMeta = true
+
+	rr := httptest.NewRecorder()
+	err := app.writeJSON(rr, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusOK, envelope{"meta": "custom"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rr.Body.String(), `"meta": "custom"`) {
+		t.Errorf("body = %s; want the handler's own meta value", rr.Body)
+	}
+}
+
+func TestReadDate(t *testing.T) {
+	almaty, err := time.LoadLocation("Asia/Almaty")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	app := newTestApplication(t)
+	app.config.location = almaty
+
+	tests := []struct {
+		query    string
+		endOfDay bool
+		want     time.Time
+		valid    bool
+	}{
+		{"", false, time.Time{}, true},
+		{"from=2024-03-01", false, time.Date(2024, 3, 1, 0, 0, 0, 0, almaty), true},
+		{"from=2024-03-01", true, time.Date(2024, 3, 1, 23, 59, 59, 999999999, almaty), true},
+		{"from=2024-02-30", false, time.Time{}, false},
+		{"from=01/03/2024", false, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		qs, _ := url.ParseQuery(tt.query)
+		v := validator.New()
+		got := app.readDate(qs, "from", tt.endOfDay, v)
+		if v.Valid() != tt.valid {
+			t.Errorf("readDate(%q): valid = %t; want %t", tt.query, v.Valid(), tt.valid)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("readDate(%q, endOfDay=%t) = %v; want %v", tt.query, tt.endOfDay, got, tt.want)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	app := newTestApplication(t)
+	instant := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if got := app.formatTime(instant); got != "2024-03-01T12:00:00Z" {
+		t.Errorf("formatTime() with no location = %q; want UTC", got)
+	}
+	app.config.location = time.FixedZone("UTC+5", 5*60*60)
+	if got := app.formatTime(instant); got != "2024-03-01T17:00:00+05:00" {
+		t.Errorf("formatTime() in UTC+5 = %q; want %q", got, "2024-03-01T17:00:00+05:00")
+	}
+}
+
+func TestAcceptsMediaType(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   bool
+	}{
+		{"empty", "", false},
+		{"exact", "application/x-ndjson", true},
+		{"case insensitive", "Application/X-NDJSON", true},
+		{"with parameters", "application/x-ndjson; q=0.9", true},
+		{"in a list", "text/html, application/x-ndjson", true},
+		{"wildcard", "*/*", false},
+		{"other type", "application/json", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept", tt.accept)
+			if got := acceptsMediaType(r, "application/x-ndjson"); got != tt.want {
+				t.Errorf("acceptsMediaType(%q) = %t; want %t", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseTrustedProxies parses a space-separated list of IP addresses and CIDR ranges
+// into the networks that proxies are trusted to connect from.
+func parseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, field := range strings.Fields(s) {
+		if !strings.Contains(field, "/") {
+			ip := net.ParseIP(field)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", field)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range %q", field)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// The fromTrustedProxy() helper reports whether the request was made by one of the
+// -trusted-proxies, whose X-Forwarded-* headers can therefore be believed.
+func (app *application) fromTrustedProxy(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range app.config.https.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// The requestScheme() helper returns the scheme the client used to make the request:
+// "https" if the connection is over TLS, otherwise the first X-Forwarded-Proto value
+// if the request came from a trusted proxy. An empty string is returned if the scheme
+// isn't known.
+func (app *application) requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if !app.fromTrustedProxy(r) {
+		return ""
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.ToLower(strings.TrimSpace(proto))
+}
+
+// The enforceHTTPS() middleware redirects requests which a trusted proxy says were
+// made over plain HTTP to the same URL over HTTPS with a 301 Moved Permanently, when
+// -https-redirect is set. Responses to requests made over HTTPS get a
+// Strict-Transport-Security header when -hsts-max-age is greater than zero.
+func (app *application) enforceHTTPS(next http.Handler) http.Handler {
+	redirect := app.config.https.redirect
+	hsts := ""
+	if maxAge := int(app.config.https.hstsMaxAge.Seconds()); maxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", maxAge)
+		if app.config.https.hstsIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+	if !redirect && hsts == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch app.requestScheme(r) {
+		case "http":
+			if redirect {
+				http.Redirect(w, r, "https://"+r.Host+r.URL.RequestURI(), http.StatusMovedPermanently)
+				return
+			}
+		case "https":
+			if hsts != "" {
+				w.Header().Set("Strict-Transport-Security", hsts)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
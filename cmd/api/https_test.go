@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"10.0.0.1", []string{"10.0.0.1/32"}, false},
+		{" 10.0.0.0/8  ::1 ", []string{"10.0.0.0/8", "::1/128"}, false},
+		{"192.168.1.7/24", []string{"192.168.1.0/24"}, false},
+		{"proxy.local", nil, true},
+		{"10.0.0.0/33", nil, true},
+	}
+	for _, tt := range tests {
+		networks, err := parseTrustedProxies(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseTrustedProxies(%q): err = %v; want error: %t", tt.input, err, tt.wantErr)
+			continue
+		}
+		if len(networks) != len(tt.want) {
+			t.Errorf("parseTrustedProxies(%q) = %v; want %v", tt.input, networks, tt.want)
+			continue
+		}
+		for i, network := range networks {
+			if network.String() != tt.want[i] {
+				t.Errorf("parseTrustedProxies(%q)[%d] = %s; want %s", tt.input, i, network, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestRequestScheme(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		proto      string
+		tls        bool
+		want       string
+	}{
+		{"tls", "203.0.113.1:1234", "", true, "https"},
+		{"tls ignores the header", "10.0.0.1:1234", "http", true, "https"},
+		{"trusted proxy", "10.0.0.1:1234", "HTTPS", false, "https"},
+		{"trusted proxy over http", "10.0.0.1:1234", "http", false, "http"},
+		{"first of several values", "10.0.0.1:1234", "http, https", false, "http"},
+		{"untrusted client", "203.0.113.1:1234", "https", false, ""},
+		{"trusted proxy without header", "10.0.0.1:1234", "", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.https.trustedProxies = []*net.IPNet{{IP: net.IPv4(10, 0, 0, 0).To4(), Mask: net.CIDRMask(8, 32)}}
+			r := httptest.NewRequest(http.MethodGet, "/v1/animes", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+
+			if got := app.requestScheme(r); got != tt.want {
+				t.Errorf("requestScheme() = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnforceHTTPS(t *testing.T) {
+	tests := []struct {
+		name       string
+		redirect   bool
+		hstsMaxAge time.Duration
+		subdomains bool
+		proto      string
+		status     int
+		location   string
+		wantHSTS   string
+	}{
+		{"redirected", true, 0, false, "http", http.StatusMovedPermanently, "https://example.com/v1/animes?page=2", ""},
+		{"redirect off", false, time.Hour, false, "http", http.StatusOK, "", ""},
+		{"hsts", false, time.Hour, false, "https", http.StatusOK, "", "max-age=3600"},
+		{"hsts with subdomains", true, 24 * time.Hour, true, "https", http.StatusOK, "", "max-age=86400; includeSubDomains"},
+		{"unknown scheme", true, time.Hour, false, "", http.StatusOK, "", ""},
+		{"disabled", false, 0, false, "http", http.StatusOK, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.https.redirect = tt.redirect
+			app.config.https.hstsMaxAge = tt.hstsMaxAge
+			app.config.https.hstsIncludeSubdomains = tt.subdomains
+			app.config.https.trustedProxies = []*net.IPNet{{IP: net.IPv4(10, 0, 0, 1).To4(), Mask: net.CIDRMask(32, 32)}}
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			r := httptest.NewRequest(http.MethodGet, "http://example.com/v1/animes?page=2", nil)
+			r.RemoteAddr = "10.0.0.1:1234"
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			rr := httptest.NewRecorder()
+			app.enforceHTTPS(next).ServeHTTP(rr, r)
+
+			if rr.Code != tt.status {
+				t.Errorf("status = %d; want %d", rr.Code, tt.status)
+			}
+			if got := rr.Header().Get("Location"); got != tt.location {
+				t.Errorf("Location = %q; want %q", got, tt.location)
+			}
+			if got := rr.Header().Get("Strict-Transport-Security"); got != tt.wantHSTS {
+				t.Errorf("Strict-Transport-Security = %q; want %q", got, tt.wantHSTS)
+			}
+		})
+	}
+}
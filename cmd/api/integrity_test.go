@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIntegrityRequiresAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+	rr := app.serveTest(t, httptest.NewRequest(http.MethodGet, "/v1/admin/integrity", nil))
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestValidateCatalogHandler(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{"page zero", "page=0", "page"},
+		{"page size too large", "page_size=101", "page_size"},
+		{"page not a number", "page=x", "page"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			r := httptest.NewRequest(http.MethodGet, "/v1/admin/validate-catalog?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			app.validateCatalogHandler(rr, r)
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+			}
+			if errs := decodeErrors(t, rr); errs[tt.field] == "" {
+				t.Errorf("errors = %v; want an error for %q", errs, tt.field)
+			}
+		})
+	}
+}
+
+func TestValidateCatalogRequiresAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+	rr := app.serveTest(t, httptest.NewRequest(http.MethodGet, "/v1/admin/validate-catalog", nil))
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
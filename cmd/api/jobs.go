@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// The schedule() helper launches a goroutine which calls fn every interval. Each run
+// is executed using the background() helper, so an in-progress run is allowed to
+// complete during a graceful shutdown. A zero or negative interval disables the job.
+func (app *application) schedule(interval time.Duration, fn func()) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			app.background(fn)
+		}
+	}()
+}
+
+// The deleteExpiredTokens() job removes expired tokens from the database and logs the
+// number of tokens which were deleted.
+func (app *application) deleteExpiredTokens() {
+	count, err := app.models.Tokens.DeleteExpired(context.Background())
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	app.logger.PrintInfo("deleted expired tokens", map[string]string{
+		"count": strconv.FormatInt(count, 10),
+	})
+}
+
+// The pruneAuditLog() job removes audit log entries older than the retention period
+// and logs the number of entries which were deleted.
+func (app *application) pruneAuditLog() {
+	count, err := app.models.Audit.DeleteOlderThan(context.Background(), time.Now().Add(-app.config.audit.retention))
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	app.logger.PrintInfo("pruned audit log", map[string]string{
+		"count": strconv.FormatInt(count, 10),
+	})
+}
+
+// The refreshSearch() helper refreshes the search indexes in the background, unless a
+// refresh is already running.
+func (app *application) refreshSearch() {
+	if !app.refreshingSearch.CompareAndSwap(false, true) {
+		return
+	}
+	app.background(func() {
+		defer app.refreshingSearch.Store(false)
+		err := app.models.Animes.RefreshSearch(context.Background())
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			return
+		}
+		app.logger.PrintInfo("refreshed search indexes", nil)
+	})
+}
+
+// The refreshSearchAfterBatch() helper schedules a search refresh if a batch inserted
+// enough animes to reach the configured threshold.
+func (app *application) refreshSearchAfterBatch(inserted int) {
+	if app.config.batch.reindexThreshold > 0 && inserted >= app.config.batch.reindexThreshold {
+		app.refreshSearch()
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"greenlight.aida.kz/internal/data"
+	"greenlight.aida.kz/internal/jsonlog"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	app := newTestApplication(t)
+
+	runs := make(chan struct{}, 1)
+	app.schedule(time.Millisecond, func() {
+		select {
+		case runs <- struct{}{}:
+		default:
+		}
+	})
+	for i := 0; i < 3; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatalf("job ran %d times; want at least 3", i)
+		}
+	}
+}
+
+func TestScheduleDisabled(t *testing.T) {
+	app := newTestApplication(t)
+
+	var runs atomic.Int32
+	app.schedule(0, func() { runs.Add(1) })
+	app.schedule(-time.Second, func() { runs.Add(1) })
+	time.Sleep(20 * time.Millisecond)
+	if n := runs.Load(); n != 0 {
+		t.Errorf("disabled job ran %d times", n)
+	}
+}
+
+func TestScheduleRecoversFromPanic(t *testing.T) {
+	app := newTestApplication(t)
+
+	runs := make(chan struct{}, 1)
+	app.schedule(time.Millisecond, func() {
+		select {
+		case runs <- struct{}{}:
+		default:
+		}
+		panic("job failed")
+	})
+	for i := 0; i < 2; i++ {
+		select {
+		case <-runs:
+		case <-time.After(time.Second):
+			t.Fatal("job stopped running after a panic")
+		}
+	}
+}
+
+func TestRefreshSearchAfterBatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		threshold     int
+		inserted      int
+		alreadyActive bool
+		wantRefresh   bool
+	}{
+		{"below the threshold", 50, 49, false, false},
+		{"at the threshold", 50, 50, false, true},
+		{"above the threshold", 50, 500, false, true},
+		{"disabled", 0, 500, false, false},
+		{"refresh already running", 50, 500, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.batch.reindexThreshold = tt.threshold
+			app.models = data.NewModels(newRefusingDB(t))
+			var logs bytes.Buffer
+			app.logger = jsonlog.New(&logs, jsonlog.LevelInfo)
+			app.refreshingSearch.Store(tt.alreadyActive)
+
+			app.refreshSearchAfterBatch(tt.inserted)
+			app.wg.Wait()
+
+			// The refresh fails against the database, and logs the error.
+			refreshed := strings.Contains(logs.String(), `"level":"ERROR"`)
+			if refreshed != tt.wantRefresh {
+				t.Errorf("refreshed = %t; want %t (logs: %s)", refreshed, tt.wantRefresh, logs.String())
+			}
+			if !tt.alreadyActive && app.refreshingSearch.Load() {
+				t.Error("refreshingSearch still set after the refresh finished")
+			}
+		})
+	}
+}
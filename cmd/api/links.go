@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"greenlight.aida.kz/internal/data"
+	"net/http"
+	"strconv"
+)
+
+// link describes a related resource or an action which can be taken on a resource.
+type link struct {
+	Href   string `json:"href"`
+	Method string `json:"method"`
+}
+
+// withLinks adds a _links object to the JSON object a resource is written as.
+type withLinks struct {
+	resource any
+	links    map[string]link
+}
+
+func (wl withLinks) MarshalJSON() ([]byte, error) {
+	js, err := json.Marshal(wl.resource)
+	if err != nil {
+		return nil, err
+	}
+	links, err := json.Marshal(map[string]map[string]link{"_links": wl.links})
+	if err != nil {
+		return nil, err
+	}
+	if len(js) < 2 || js[0] != '{' {
+		return nil, fmt.Errorf("cannot add links to non-object %T", wl.resource)
+	}
+	return extendObject(js, links), nil
+}
+
+// extendObject adds the members of the JSON object fields to the end of the JSON
+// object js, by inserting them before its closing brace. A comma is added unless js
+// is empty.
+func extendObject(js, fields []byte) []byte {
+	out := append([]byte{}, js[:len(js)-1]...)
+	if len(js) > 2 {
+		out = append(out, ',')
+	}
+	return append(out, fields[1:]...)
+}
+
+// wantLinks reports whether the client asked for links to be included in resources
+// with ?links=true.
+func wantLinks(r *http.Request) bool {
+	include, err := strconv.ParseBool(r.URL.Query().Get("links"))
+	return err == nil && include
+}
+
+// animeLinks returns the links for an anime, leaving out the actions which a user
+// with the given permissions isn't allowed to take.
+func animeLinks(id int64, permissions data.Permissions) map[string]link {
+	self := fmt.Sprintf("/v1/animes/%d", id)
+	links := make(map[string]link)
+	if permissions.Include("animes:read") {
+		links["self"] = link{Href: self, Method: http.MethodGet}
+		links["ratings"] = link{Href: fmt.Sprintf("/v1/animes/ratings?ids=%d", id), Method: http.MethodGet}
+	}
+	if permissions.Include("animes:write") {
+		links["update"] = link{Href: self, Method: http.MethodPatch}
+		links["delete"] = link{Href: self, Method: http.MethodDelete}
+	}
+	return links
+}
+
+// The requestPermissions() helper returns the permissions of the user making the
+// request. They're taken from the request context if requirePermission() has already
+// looked them up, and fetched otherwise. The links only make actions more
+// discoverable, so if the permissions can't be fetched the error is logged and no
+// permissions are returned rather than failing the request.
+func (app *application) requestPermissions(r *http.Request) data.Permissions {
+	if permissions, ok := app.contextGetPermissions(r); ok {
+		return permissions
+	}
+	user := app.contextGetUser(r)
+	if user.IsAnonymous() {
+		return nil
+	}
+	permissions, err := app.models.Permissions.GetAllForUser(app.dbContext(r), user.ID)
+	if err != nil {
+		app.logError(r, err)
+		return nil
+	}
+	return permissions
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"greenlight.aida.kz/internal/data"
+	"greenlight.aida.kz/internal/jsonlog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithLinksMarshalJSON(t *testing.T) {
+	links := map[string]link{"self": {Href: "/v1/animes/1", Method: http.MethodGet}}
+	tests := []struct {
+		name     string
+		resource any
+		want     string
+		wantErr  bool
+	}{
+		{"object", map[string]int{"id": 1}, `{"id":1,"_links":{"self":{"href":"/v1/animes/1","method":"GET"}}}`, false},
+		{"empty object", struct{}{}, `{"_links":{"self":{"href":"/v1/animes/1","method":"GET"}}}`, false},
+		{"not an object", []int{1}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			js, err := json.Marshal(withLinks{resource: tt.resource, links: links})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v; want error: %t", err, tt.wantErr)
+			}
+			if string(js) != tt.want {
+				t.Errorf("got %s; want %s", js, tt.want)
+			}
+		})
+	}
+}
+
+func TestWantLinks(t *testing.T) {
+	tests := map[string]bool{
+		"":               false,
+		"links=true":     true,
+		"links=1":        true,
+		"links=false":    false,
+		"links=maybe":    false,
+		"nulls=explicit": false,
+	}
+	for query, want := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/v1/animes?"+query, nil)
+		if got := wantLinks(r); got != want {
+			t.Errorf("wantLinks(%q) = %t; want %t", query, got, want)
+		}
+	}
+}
+
+func TestAnimeLinks(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions data.Permissions
+		want        []string
+	}{
+		{"none", nil, nil},
+		{"read", data.Permissions{"animes:read"}, []string{"ratings", "self"}},
+		{"write only", data.Permissions{"animes:write"}, []string{"delete", "update"}},
+		{"read and write", data.Permissions{"animes:read", "animes:write"}, []string{"delete", "ratings", "self", "update"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links := animeLinks(7, tt.permissions)
+			var got []string
+			for _, name := range []string{"delete", "ratings", "self", "update"} {
+				if _, ok := links[name]; ok {
+					got = append(got, name)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("links = %v; want %v", links, tt.want)
+			}
+		})
+	}
+
+	links := animeLinks(7, data.Permissions{"animes:read", "animes:write"})
+	want := map[string]link{
+		"self":    {Href: "/v1/animes/7", Method: http.MethodGet},
+		"ratings": {Href: "/v1/animes/ratings?ids=7", Method: http.MethodGet},
+		"update":  {Href: "/v1/animes/7", Method: http.MethodPatch},
+		"delete":  {Href: "/v1/animes/7", Method: http.MethodDelete},
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("links = %v; want %v", links, want)
+	}
+}
+
+func TestPresentAnimeLinks(t *testing.T) {
+	app := newTestApplication(t)
+	anime := &data.Anime{ID: 7, Title: "Akira"}
+
+	r := app.newRequest(http.MethodGet, "/v1/animes/7?links=true", "", &data.User{ID: 1, Activated: true})
+	r = app.contextSetPermissions(r, data.Permissions{"animes:read"})
+	js, err := json.Marshal(app.presentAnimes(r, []*data.Anime{anime}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []struct {
+		Title string          `json:"title"`
+		Links map[string]link `json:"_links"`
+	}
+	if err := json.Unmarshal(js, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Title != "Akira" || len(got[0].Links) != 2 || got[0].Links["update"].Href != "" {
+		t.Errorf("presented %s; want a read-only anime with self and ratings links", js)
+	}
+
+	r = app.newRequest(http.MethodGet, "/v1/animes/7", "", &data.User{ID: 1, Activated: true})
+	js, err = json.Marshal(app.presentAnime(r, anime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(js), "_links") {
+		t.Errorf("presented %s; want no links without ?links=true", js)
+	}
+}
+
+func TestPresentResults(t *testing.T) {
+	app := newTestApplication(t)
+	results := []*data.SearchResult{
+		{Anime: &data.Anime{ID: 7, Title: "Akira", MediaType: data.MediaMovie}, MatchType: "title", Relevance: 0.5},
+	}
+
+	r := app.newRequest(http.MethodGet, "/v1/search?q=akira&links=true&nulls=explicit", "", &data.User{ID: 1, Activated: true})
+	r = app.contextSetPermissions(r, data.Permissions{"animes:read"})
+	js, err := json.Marshal(app.presentResults(r, results))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]json.RawMessage
+	if err := json.Unmarshal(js, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("presented %s; want 1 result", js)
+	}
+	want := map[string]string{
+		"title":      `"Akira"`,
+		"year":       "null",
+		"match_type": `"title"`,
+		"relevance":  "0.5",
+		"_links":     `{"ratings":{"href":"/v1/animes/ratings?ids=7","method":"GET"},"self":{"href":"/v1/animes/7","method":"GET"}}`,
+	}
+	for key, value := range want {
+		if string(got[0][key]) != value {
+			t.Errorf("%s = %s; want %s", key, got[0][key], value)
+		}
+	}
+
+	r = app.newRequest(http.MethodGet, "/v1/search?q=akira", "", &data.User{ID: 1, Activated: true})
+	js, err = json.Marshal(app.presentResults(r, results))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[{"id":7,"title":"Akira","media_type":"Movie","episodes_count":null,"status":"","version":0,"match_type":"title","relevance":0.5}]`; string(js) != want {
+		t.Errorf("presented %s; want %s", js, want)
+	}
+}
+
+func TestRequestPermissionsLookupFailure(t *testing.T) {
+	var logs bytes.Buffer
+	app := newTestApplication(t)
+	app.logger = jsonlog.New(&logs, jsonlog.LevelInfo)
+	app.models = data.NewModels(newRefusingDB(t))
+
+	anonymous := app.newRequest(http.MethodGet, "/v1/users/me/favorites?links=true", "", data.AnonymousUser)
+	if got := app.requestPermissions(anonymous); got != nil {
+		t.Errorf("anonymous permissions = %v; want none", got)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("logged %s for an anonymous user", logs.String())
+	}
+
+	// A failed lookup leaves out the links rather than failing the request.
+	r := app.newRequest(http.MethodGet, "/v1/users/me/favorites?links=true", "", &data.User{ID: 1, Activated: true})
+	if got := app.requestPermissions(r); got != nil {
+		t.Errorf("permissions = %v; want none", got)
+	}
+	if !strings.Contains(logs.String(), `"level":"ERROR"`) {
+		t.Errorf("log = %s; want the lookup error", logs.String())
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"greenlight.aida.kz/internal/data"
+	"greenlight.aida.kz/internal/validator"
+	"net/http"
+)
+
+// The mergeAnimeHandler() method merges the anime in the URL into the anime given by
+// the "into" field of the request body, for cleaning up duplicates.
+func (app *application) mergeAnimeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Into *data.ID `json:"into"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.Into != nil, "into", "must be provided")
+	if input.Into != nil {
+		v.Check(*input.Into > 0, "into", "must be a positive integer")
+		v.Check(int64(*input.Into) != id, "into", "must be a different anime")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	report, err := app.models.Animes.Merge(app.dbContext(r), id, int64(*input.Into))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.audit(r, data.AuditMerge, "anime", id)
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"merge": report}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
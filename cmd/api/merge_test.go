@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"greenlight.aida.kz/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMergeAnimeHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		status int
+		want   string
+	}{
+		{"invalid id", "x", `{"into": 2}`, http.StatusNotFound, ""},
+		{"badly-formed JSON", "1", `{"into": `, http.StatusBadRequest, ""},
+		{"unknown field", "1", `{"into": 2, "from": 1}`, http.StatusBadRequest, ""},
+		{"missing into", "1", `{}`, http.StatusUnprocessableEntity, "must be provided"},
+		{"zero into", "1", `{"into": 0}`, http.StatusUnprocessableEntity, "must be a positive integer"},
+		{"into itself", "1", `{"into": 1}`, http.StatusUnprocessableEntity, "must be a different anime"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			r := app.newRequest(http.MethodPost, "/v1/animes/"+tt.id+"/merge", tt.body, &data.User{ID: 1, Activated: true})
+			r = withParams(r, httprouter.Params{{Key: "id", Value: tt.id}})
+			rr := httptest.NewRecorder()
+			app.mergeAnimeHandler(rr, r)
+
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d; want %d (body: %s)", rr.Code, tt.status, rr.Body)
+			}
+			if tt.want != "" {
+				if got := decodeErrors(t, rr)["into"]; got != tt.want {
+					t.Errorf("errors[into] = %q; want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeAnimeRequiresAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+	rr := app.serveTest(t, httptest.NewRequest(http.MethodPost, "/v1/animes/1/merge", nil))
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
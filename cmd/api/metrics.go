@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sizeBuckets holds the upper bounds (inclusive, in bytes) of the buckets used for
+// the body size histograms. Anything larger falls into a final "+Inf" bucket.
+var sizeBuckets = []int64{0, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// sizeHistogram is a cumulative histogram of body sizes, which publishes itself
+// through expvar as a JSON object.
+type sizeHistogram struct {
+	mu     sync.Mutex
+	counts []int64
+	count  int64
+	sum    int64
+}
+
+func newSizeHistogram() *sizeHistogram {
+	return &sizeHistogram{counts: make([]int64, len(sizeBuckets)+1)}
+}
+
+func (h *sizeHistogram) observe(n int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range sizeBuckets {
+		if n <= bound {
+			h.counts[i]++
+		}
+	}
+	h.counts[len(sizeBuckets)]++
+	h.count++
+	h.sum += n
+}
+
+// String returns the histogram as JSON, satisfying the expvar.Var interface.
+func (h *sizeHistogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	buckets := make([]string, 0, len(h.counts))
+	for i, bound := range sizeBuckets {
+		buckets = append(buckets, fmt.Sprintf(`"le_%d": %d`, bound, h.counts[i]))
+	}
+	buckets = append(buckets, fmt.Sprintf(`"le_+Inf": %d`, h.counts[len(sizeBuckets)]))
+	return fmt.Sprintf(`{"buckets": {%s}, "count": %d, "sum": %d}`, strings.Join(buckets, ", "), h.count, h.sum)
+}
+
+// The body size histograms are published once per process, keyed by "METHOD
+// pattern". They must be package-level because expvar panics if the same name is
+// published twice.
+var (
+	requestBodyBytes  = expvar.NewMap("request_body_bytes")
+	responseBodyBytes = expvar.NewMap("response_body_bytes")
+	histogramsMu      sync.Mutex
+)
+
+// histogram returns the histogram for key in m, creating it if necessary.
+func histogram(m *expvar.Map, key string) *sizeHistogram {
+	histogramsMu.Lock()
+	defer histogramsMu.Unlock()
+	if h, ok := m.Get(key).(*sizeHistogram); ok {
+		return h
+	}
+	h := newSizeHistogram()
+	m.Set(key, h)
+	return h
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// metricsResponseWriter records the status code and the number of bytes written to
+// a response.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	n          int64
+}
+
+func (mw *metricsResponseWriter) WriteHeader(statusCode int) {
+	if mw.statusCode == 0 {
+		mw.statusCode = statusCode
+	}
+	mw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (mw *metricsResponseWriter) Write(b []byte) (int, error) {
+	if mw.statusCode == 0 {
+		mw.statusCode = http.StatusOK
+	}
+	n, err := mw.ResponseWriter.Write(b)
+	mw.n += int64(n)
+	return n, err
+}
+
+// Flush passes through to the underlying ResponseWriter, so that streaming handlers
+// keep working when wrapped.
+func (mw *metricsResponseWriter) Flush() {
+	if f, ok := mw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+// The metrics() middleware records the size of each request and response body in
+// per-route histograms, which are published at GET /debug/vars to users with the
+// users:admin permission. It also logs a warning for any request which took longer
+// than the -slow-request-threshold.
+func (app *application) metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &routeInfo{}
+		r = r.WithContext(context.WithValue(r.Context(), routeContextKey, info))
+
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		mw := &metricsResponseWriter{ResponseWriter: w}
+
+		next.ServeHTTP(mw, r)
+
+		key := r.Method + " " + app.routePattern(r)
+		histogram(requestBodyBytes, key).observe(body.n)
+		histogram(responseBodyBytes, key).observe(mw.n)
+
+		threshold := app.config.slowRequests.threshold
+		if elapsed := time.Since(app.requestStart(r)); threshold > 0 && elapsed > threshold {
+			// The request ID is added to the context further down the middleware
+			// chain, so read it back from the response header instead.
+			app.logger.PrintWarning("slow request", map[string]string{
+				"request_method": r.Method,
+				"request_route":  app.routePattern(r),
+				"status":         strconv.Itoa(mw.statusCode),
+				"request_id":     mw.Header().Get("X-Request-ID"),
+				"elapsed":        elapsed.String(),
+			})
+		}
+	})
+}
+
+// The route() wrapper records the pattern that a handler was registered with in the
+// request's routeInfo. It also sends a 406 Not Acceptable response, before the
+// handler runs, if the Accept header rules out every media type that the route
+// responds with (see routeMediaTypes).
+func (app *application) route(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(routeContextKey).(*routeInfo); ok {
+			info.pattern = pattern
+		}
+		if !app.acceptable(r, pattern) {
+			app.notAcceptableResponse(w, r, routeSupportedTypes(pattern))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// debugVarsHandler writes the published expvar variables as a JSON object, in the
+// same format as expvar.Handler(), but leaves out "cmdline" because the command line
+// arguments include secrets such as the database DSN and the SMTP password.
+func (app *application) debugVarsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if kv.Key == "cmdline" {
+			return
+		}
+		if !first {
+			fmt.Fprintf(w, ",\n")
+		}
+		first = false
+		fmt.Fprintf(w, "%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(w, "\n}\n")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"greenlight.aida.kz/internal/jsonlog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSizeHistogram(t *testing.T) {
+	h := newSizeHistogram()
+	for _, n := range []int64{0, 100, 5000, 2 << 20} {
+		h.observe(n)
+	}
+
+	var got struct {
+		Buckets map[string]int64 `json:"buckets"`
+		Count   int64            `json:"count"`
+		Sum     int64            `json:"sum"`
+	}
+	if err := json.Unmarshal([]byte(h.String()), &got); err != nil {
+		t.Fatalf("String() is not valid JSON: %v", err)
+	}
+	if got.Count != 4 || got.Sum != 0+100+5000+2<<20 {
+		t.Errorf("count, sum = %d, %d; want 4, %d", got.Count, got.Sum, 0+100+5000+2<<20)
+	}
+	want := map[string]int64{"le_0": 1, "le_256": 2, "le_4096": 2, "le_16384": 3, "le_1048576": 3, "le_+Inf": 4}
+	for bucket, n := range want {
+		if got.Buckets[bucket] != n {
+			t.Errorf("bucket %s = %d; want %d", bucket, got.Buckets[bucket], n)
+		}
+	}
+}
+
+func TestDebugVarsHandler(t *testing.T) {
+	histogram(requestBodyBytes, "GET /v1/healthcheck").observe(10)
+
+	app := &application{}
+	rr := httptest.NewRecorder()
+	app.debugVarsHandler(rr, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+	if _, ok := vars["cmdline"]; ok {
+		t.Error("response includes cmdline")
+	}
+	for _, key := range []string{"memstats", "request_body_bytes", "response_body_bytes"} {
+		if _, ok := vars[key]; !ok {
+			t.Errorf("response is missing %q", key)
+		}
+	}
+}
+
+func TestSlowRequestWarning(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold time.Duration
+		delay     time.Duration
+		warned    bool
+	}{
+		{"disabled", 0, 20 * time.Millisecond, false},
+		{"fast", time.Second, 0, false},
+		{"slow", 5 * time.Millisecond, 20 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			app := newTestApplication(t)
+			app.logger = jsonlog.New(&buf, jsonlog.LevelInfo)
+			app.config.slowRequests.threshold = tt.threshold
+
+			next := app.route("/v1/animes", func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(tt.delay)
+				w.Header().Set("X-Request-ID", "abc")
+				w.WriteHeader(http.StatusTeapot)
+			})
+			handler := app.recordStart(app.metrics(next))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/v1/animes", nil))
+
+			logs := buf.String()
+			if warned := strings.Contains(logs, "slow request"); warned != tt.warned {
+				t.Fatalf("warned = %t; want %t (log: %s)", warned, tt.warned, logs)
+			}
+			if !tt.warned {
+				return
+			}
+			for _, want := range []string{`"request_route":"/v1/animes"`, `"status":"418"`, `"request_id":"abc"`, `"request_method":"GET"`} {
+				if !strings.Contains(logs, want) {
+					t.Errorf("log missing %s: %s", want, logs)
+				}
+			}
+		})
+	}
+}
@@ -1,18 +1,37 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
+	"github.com/julienschmidt/httprouter"
 	"golang.org/x/time/rate"
 	"greenlight.aida.kz/internal/data"
 	"greenlight.aida.kz/internal/validator"
+	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
+// The recordStart() middleware stores the time that the request was received in the
+// request context. It should be the outermost middleware in the chain, so that the
+// time can be read by everything after it using requestStart().
+func (app *application) recordStart(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requestStartContextKey, time.Now())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -25,31 +44,67 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) rateLimit(next http.Handler) http.Handler {
+// rateLimiterBackend is the store behind a rate limiter. The in-memory ipRateLimiter
+// never fails, but a shared backend (such as Redis) can, in which case allow() returns
+// an error and the -limiter-fail-open setting decides what happens to the request.
+type rateLimiterBackend interface {
+	allow(ip string) (bool, error)
+}
 
-	type client struct {
-		limiter  *rate.Limiter
-		lastSeen time.Time
-	}
+// ipRateLimiter holds a token-bucket rate limiter for each client IP address, using
+// the same rps and burst values for every client.
+type ipRateLimiter struct {
+	mu      sync.Mutex
+	rps     float64
+	burst   int
+	clients map[string]*rateLimitClient
+}
 
-	var (
-		mu      sync.Mutex
-		clients = make(map[string]*client)
-	)
+type rateLimitClient struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
 
+// newIPRateLimiter returns a new ipRateLimiter and launches a background goroutine
+// which removes clients that haven't been seen for three minutes.
+func newIPRateLimiter(rps float64, burst int) *ipRateLimiter {
+	l := &ipRateLimiter{
+		rps:     rps,
+		burst:   burst,
+		clients: make(map[string]*rateLimitClient),
+	}
 	go func() {
 		for {
 			time.Sleep(time.Minute)
-			mu.Lock()
-			for ip, client := range clients {
+			l.mu.Lock()
+			for ip, client := range l.clients {
 				if time.Since(client.lastSeen) > 3*time.Minute {
-					delete(clients, ip)
+					delete(l.clients, ip)
 				}
 			}
-			mu.Unlock()
+			l.mu.Unlock()
 		}
 	}()
+	return l
+}
+
+// allow reports whether a request from the given IP address is permitted.
+func (l *ipRateLimiter) allow(ip string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, found := l.clients[ip]; !found {
+		l.clients[ip] = &rateLimitClient{
+			limiter: rate.NewLimiter(rate.Limit(l.rps), l.burst),
+		}
+	}
+	l.clients[ip].lastSeen = time.Now()
+	return l.clients[ip].limiter.Allow(), nil
+}
 
+// limit returns middleware which rate limits requests using the given limiter. If the
+// limiter's backend fails the request is let through in fail-open mode, and rejected
+// with a 503 Service Unavailable response otherwise.
+func (app *application) limit(l rateLimiterBackend, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.limiter.enabled {
 			ip, _, err := net.SplitHostPort(r.RemoteAddr)
@@ -57,23 +112,199 @@ func (app *application) rateLimit(next http.Handler) http.Handler {
 				app.serverErrorResponse(w, r, err)
 				return
 			}
-			mu.Lock()
-			if _, found := clients[ip]; !found {
-				clients[ip] = &client{
-					limiter: rate.NewLimiter(rate.Limit(app.config.limiter.rps), app.config.limiter.burst),
+			allowed, err := l.allow(ip)
+			if err != nil {
+				app.logError(r, err)
+				if !app.config.limiter.failOpen {
+					app.serviceUnavailableResponse(w, r, 0)
+					return
 				}
+				allowed = true
 			}
-			clients[ip].lastSeen = time.Now()
-			if !clients[ip].limiter.Allow() {
-				mu.Unlock()
+			if !allowed {
 				app.rateLimitExceededResponse(w, r)
 				return
 			}
-			mu.Unlock()
 		}
 		next.ServeHTTP(w, r)
 	})
+}
+
+// requestIDRX matches the client-supplied request IDs that we're prepared to honor:
+// UUIDs, or any other short string of URL-safe characters. Anything else is replaced
+// with a generated ID, so that arbitrary client input can't end up in our logs.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
 
+// The requestID() middleware assigns an ID to each request. If the client sent a
+// valid X-Request-ID header then that ID is used, so requests can be traced across
+// systems; otherwise a random UUID is generated. The ID is stored in the request
+// context and echoed to the client in the X-Request-ID header.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validator.Matches(id, requestIDRX) {
+			var err error
+			id, err = newRequestID()
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+		w.Header().Set("X-Request-ID", id)
+		r = app.contextSetRequestID(r, id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newRequestID generates a random (version 4) UUID.
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// sensitiveBodyFieldRX matches the string values of JSON fields in a request body
+// which must never be logged, along with the field name (in the first group).
+var sensitiveBodyFieldRX = regexp.MustCompile(`(?i)("(?:password|token|secret|authorization|api_key)"\s*:\s*)"(?:[^"\\]|\\.)*"?`)
+
+// teeBody wraps a request body, keeping a copy of the first limit bytes read from it.
+type teeBody struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	room := t.limit - t.buf.Len()
+	if room < 0 {
+		room = 0
+	}
+	if n > room {
+		t.buf.Write(p[:room])
+		t.truncated = true
+	} else {
+		t.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+// The logRequestBody() middleware logs the body of each write request (POST, PUT,
+// PATCH and DELETE) once it has been handled, to help debug client payloads. It only
+// runs in development with -log-request-bodies set. The body is copied as the handler
+// reads it rather than up front, so the handler sees it unchanged. Only the first
+// -log-request-body-bytes are logged, and the values of sensitive fields such as
+// passwords and tokens are redacted.
+func (app *application) logRequestBody(next http.Handler) http.Handler {
+	if app.config.env != "development" || !app.config.debug.logBodies {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		body := &teeBody{ReadCloser: r.Body, limit: app.config.debug.bodyLogBytes}
+		r.Body = body
+		next.ServeHTTP(w, r)
+
+		app.logger.PrintInfo("request body", map[string]string{
+			"request_id":     app.contextGetRequestID(r),
+			"request_method": r.Method,
+			"request_url":    r.URL.String(),
+			"body":           sensitiveBodyFieldRX.ReplaceAllString(body.buf.String(), `${1}"[REDACTED]"`),
+			"truncated":      strconv.FormatBool(body.truncated),
+		})
+	})
+}
+
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	return app.limit(newIPRateLimiter(app.config.limiter.rps, app.config.limiter.burst), next)
+}
+
+// The rateLimitRoute() middleware applies the override for the named route from the
+// routeRateLimits map, on top of the global rate limit. Routes without an override
+// are passed straight through.
+func (app *application) rateLimitRoute(route string, next http.HandlerFunc) http.HandlerFunc {
+	override, ok := routeRateLimits[route]
+	if !ok {
+		return next
+	}
+	return app.limit(newIPRateLimiter(override.rps, override.burst), next).ServeHTTP
+}
+
+// The limitConcurrency() middleware caps the number of requests to the named route
+// which are handled at the same time, using the limit from the routeConcurrency map.
+// Requests over the cap get a 503 Service Unavailable response straight away, so an
+// expensive route can't tie up the resources needed by other routes. Routes without
+// a limit are passed straight through.
+func (app *application) limitConcurrency(route string, next http.HandlerFunc) http.HandlerFunc {
+	limit, ok := routeConcurrency[route]
+	if !ok || limit <= 0 {
+		return next
+	}
+	sem := make(chan struct{}, limit)
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next(w, r)
+		default:
+			app.serviceUnavailableResponse(w, r, 0)
+		}
+	}
+}
+
+// The queryBudget() middleware counts the database queries run for each request, and
+// logs a warning when there are more than the -db-query-budget, which usually points
+// to an N+1 query pattern. Handlers pass dbContext() to the models, so every query
+// run for the request is counted, including those made by middleware such as
+// authenticate(). Background jobs run outside of any request and aren't counted.
+func (app *application) queryBudget(next http.Handler) http.Handler {
+	budget := app.config.db.queryBudget
+	if budget <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, counter := data.WithQueryCounter(r.Context())
+		r = r.WithContext(ctx)
+		next.ServeHTTP(w, r)
+
+		if count := counter.Load(); count > int64(budget) {
+			app.logger.PrintWarning("query budget exceeded", map[string]string{
+				"request_id":     app.contextGetRequestID(r),
+				"request_method": r.Method,
+				"request_route":  app.routePattern(r),
+				"queries":        strconv.FormatInt(count, 10),
+				"budget":         strconv.Itoa(budget),
+			})
+		}
+	})
+}
+
+// The acquireStream() helper reserves one of the -max-streams slots for a response
+// which is streamed to the client, and so holds its connection open for longer than
+// usual. The slots are shared by every streaming handler, separately from any
+// per-route concurrency limit. It returns false if every slot is in use; otherwise
+// the returned release function must be called once the stream has finished.
+func (app *application) acquireStream() (release func(), ok bool) {
+	if app.streams == nil {
+		return func() {}, true
+	}
+	select {
+	case app.streams <- struct{}{}:
+		return func() { <-app.streams }, true
+	default:
+		return nil, false
+	}
 }
 
 func (app *application) authenticate(next http.Handler) http.Handler {
@@ -119,7 +350,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// again calling the invalidAuthenticationTokenResponse() helper if no
 		// matching record was found. IMPORTANT: Notice that we are using
 		// ScopeAuthentication as the first parameter here.
-		user, err := app.models.Users.GetForToken(data.ScopeAuthentication, token)
+		user, err := app.models.Users.GetForToken(app.dbContext(r), data.ScopeAuthentication, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -129,6 +360,11 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			}
 			return
 		}
+		// Suspended users keep their tokens, but they aren't allowed to use them.
+		if user.Suspended {
+			app.suspendedAccountResponse(w, r)
+			return
+		}
 		// Call the contextSetUser() helper to add the user information to the request
 		// context.
 		r = app.contextSetUser(r, user)
@@ -153,11 +389,15 @@ func (app *application) requireActivatedUser(next http.HandlerFunc) http.Handler
 	// Rather than returning this http.HandlerFunc we assign it to the variable fn.
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := app.contextGetUser(r)
-		// Check that a user is activated.
+		// Check that a user is activated and hasn't been suspended.
 		if !user.Activated {
 			app.inactiveAccountResponse(w, r)
 			return
 		}
+		if user.Suspended {
+			app.suspendedAccountResponse(w, r)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 	// Wrap fn with the requireAuthenticatedUser() middleware before returning it.
@@ -169,7 +409,7 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 		// Retrieve the user from the request context.
 		user := app.contextGetUser(r)
 		// Get the slice of permissions for the user.
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+		permissions, err := app.models.Permissions.GetAllForUser(app.dbContext(r), user.ID)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
@@ -181,9 +421,114 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 			return
 		}
 		// Otherwise they have the required permission so we call the next handler in
-		// the chain.
-		next.ServeHTTP(w, r)
+		// the chain, keeping the permissions in the context so that they don't have to
+		// be looked up again.
+		next.ServeHTTP(w, app.contextSetPermissions(r, permissions))
 	}
 	// Wrap this with the requireActivatedUser() middleware before returning it.
 	return app.requireActivatedUser(fn)
 }
+
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+		if origin != "" {
+			for _, trusted := range app.config.cors.trustedOrigins {
+				if !originMatches(trusted, origin) {
+					continue
+				}
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				// Treat an OPTIONS request with the Access-Control-Request-Method header
+				// as a preflight request, and respond to it directly.
+				if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+					w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
+					w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				break
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// originMatches reports whether a request Origin matches a trusted origin. A trusted
+// origin is either matched exactly, or it can contain a wildcard as the first label
+// of the host (like https://*.example.com). A wildcard matches exactly one label, so
+// https://*.example.com matches https://app.example.com, but not
+// https://example.com, https://a.b.example.com or http://app.example.com.
+func originMatches(trusted, origin string) bool {
+	if trusted == origin {
+		return true
+	}
+	scheme, host, ok := strings.Cut(trusted, "://*.")
+	if !ok {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme != scheme || u.Path != "" || u.RawQuery != "" || u.User != nil {
+		return false
+	}
+	label, rest, ok := strings.Cut(u.Host, ".")
+	if !ok || label == "" || rest != host {
+		return false
+	}
+	return !strings.ContainsAny(label, "*:")
+}
+
+// The limitHeaders() middleware rejects requests carrying more header fields than
+// the configured maximum with a 431 Request Header Fields Too Large response. Their
+// total size is limited separately by the server's MaxHeaderBytes setting.
+func (app *application) limitHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.headers.maxCount > 0 {
+			count := 0
+			for _, values := range r.Header {
+				count += len(values)
+			}
+			if count > app.config.headers.maxCount {
+				app.headersTooLargeResponse(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The trailingSlash() middleware handles request paths with a trailing slash (other
+// than "/") according to the -trailing-slash setting. In "redirect" mode the client
+// is sent a 308 Permanent Redirect to the path without the slash, in "strip" mode the
+// slash is removed and the request handled as if it wasn't there, and in "off" mode
+// the path is left alone (so it will usually 404). The path without the slash is
+// cleaned, and only used if it matches one of the router's routes; anything else is
+// passed on unchanged to get the usual 404. This stops paths like "//example.com/"
+// from being redirected to another host.
+func (app *application) trailingSlash(router *httprouter.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.trailingSlash == "off" || r.URL.Path == "/" || !strings.HasSuffix(r.URL.Path, "/") {
+			router.ServeHTTP(w, r)
+			return
+		}
+		canonical := path.Clean(r.URL.Path)
+		if handle, _, _ := router.Lookup(r.Method, canonical); handle == nil {
+			router.ServeHTTP(w, r)
+			return
+		}
+		switch app.config.trailingSlash {
+		case "redirect":
+			u := *r.URL
+			u.Path = canonical
+			u.RawPath = ""
+			http.Redirect(w, r, u.String(), http.StatusPermanentRedirect)
+			return
+		case "strip":
+			r.URL.Path = canonical
+			r.URL.RawPath = ""
+		}
+		router.ServeHTTP(w, r)
+	})
+}
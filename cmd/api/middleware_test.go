@@ -0,0 +1,597 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/julienschmidt/httprouter"
+	"greenlight.aida.kz/internal/data"
+	"greenlight.aida.kz/internal/jsonlog"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// okHandler is a handler which always sends an empty 200 OK response.
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestRateLimitRoute(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.limiter.enabled = true
+
+	tests := []struct {
+		route string
+		want  []int
+	}{
+		// The search override has a burst of 2.
+		{"search", []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}},
+		{"export", []int{http.StatusOK, http.StatusTooManyRequests}},
+		{"no-override", []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			handler := app.rateLimitRoute(tt.route, okHandler)
+			for i, want := range tt.want {
+				rr := httptest.NewRecorder()
+				handler(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+				if rr.Code != want {
+					t.Errorf("request %d: status = %d; want %d", i+1, rr.Code, want)
+				}
+			}
+		})
+	}
+}
+
+// runQueries simulates n queries being run with ctx, as seen by the pool's tracer.
+func runQueries(ctx context.Context, n int) {
+	for i := 0; i < n; i++ {
+		data.QueryCountTracer{}.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{})
+	}
+}
+
+func TestQueryBudget(t *testing.T) {
+	tests := []struct {
+		name    string
+		queries int
+		warned  bool
+	}{
+		{"within budget", 3, false},
+		{"at budget", 5, false},
+		{"over budget", 6, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			app := newTestApplication(t)
+			app.logger = jsonlog.New(&buf, jsonlog.LevelInfo)
+			app.config.db.queryBudget = 5
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				runQueries(app.dbContext(r), tt.queries)
+			})
+			app.queryBudget(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if warned := strings.Contains(buf.String(), "query budget exceeded"); warned != tt.warned {
+				t.Errorf("warned = %t; want %t (log: %s)", warned, tt.warned, buf.String())
+			}
+		})
+	}
+}
+
+func TestDetachKeepsQueryCounter(t *testing.T) {
+	ctx, counter := data.WithQueryCounter(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+
+	detached := detach(ctx)
+	if detached.Err() != nil {
+		t.Errorf("detached context Err() = %v; want nil", detached.Err())
+	}
+	if _, ok := detached.Deadline(); ok {
+		t.Error("detached context has a deadline")
+	}
+	runQueries(detached, 2)
+	if got := counter.Load(); got != 2 {
+		t.Errorf("counter = %d; want 2", got)
+	}
+}
+
+func TestDetachIgnoresDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	select {
+	case <-detach(ctx).Done():
+		t.Error("detached context is done")
+	default:
+	}
+}
+
+func TestRequireActivatedUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    *data.User
+		status  int
+		message string
+	}{
+		{"anonymous", data.AnonymousUser, http.StatusUnauthorized, "you must be authenticated to access this resource"},
+		{"not activated", &data.User{ID: 1}, http.StatusForbidden, "your user account must be activated to access this resource"},
+		{"suspended", &data.User{ID: 1, Activated: true, Suspended: true}, http.StatusForbidden, "your user account has been suspended"},
+		{"active", &data.User{ID: 1, Activated: true}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := httptest.NewRecorder()
+			app.requireActivatedUser(okHandler)(rr, app.newRequest(http.MethodGet, "/", "", tt.user))
+
+			if rr.Code != tt.status {
+				t.Errorf("status = %d; want %d", rr.Code, tt.status)
+			}
+			if tt.message != "" && !strings.Contains(rr.Body.String(), tt.message) {
+				t.Errorf("body = %s; want message %q", rr.Body, tt.message)
+			}
+		})
+	}
+}
+
+func TestOriginMatches(t *testing.T) {
+	tests := []struct {
+		trusted string
+		origin  string
+		want    bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://example.com", "https://app.example.com", false},
+		{"https://*.example.com", "https://app.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://a.b.example.com", false},
+		{"https://*.example.com", "http://app.example.com", false},
+		{"https://*.example.com", "https://app.example.com.evil.test", false},
+		{"https://*.example.com", "https://appexample.com", false},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "https://app.example.com:8443", false},
+		{"https://*.example.com:8443", "https://app.example.com:8443", true},
+		{"https://*.example.com", "https://app.example.com/path", false},
+		{"https://*.example.com", "https://user@app.example.com", false},
+	}
+	for _, tt := range tests {
+		if got := originMatches(tt.trusted, tt.origin); got != tt.want {
+			t.Errorf("originMatches(%q, %q) = %t; want %t", tt.trusted, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestEnableCORS(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.cors.trustedOrigins = []string{"https://*.example.com"}
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		preflight   bool
+		wantAllowed bool
+		wantStatus  int
+	}{
+		{"trusted", http.MethodGet, "https://app.example.com", false, true, http.StatusOK},
+		{"untrusted", http.MethodGet, "https://evil.test", false, false, http.StatusOK},
+		{"trusted preflight", http.MethodOptions, "https://app.example.com", true, true, http.StatusOK},
+		{"untrusted preflight", http.MethodOptions, "https://evil.test", true, false, http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodOptions {
+					w.WriteHeader(http.StatusTeapot)
+				}
+			})
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("Origin", tt.origin)
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", http.MethodPatch)
+			}
+			rr := httptest.NewRecorder()
+			app.enableCORS(next).ServeHTTP(rr, r)
+
+			allowed := rr.Header().Get("Access-Control-Allow-Origin") == tt.origin
+			if allowed != tt.wantAllowed {
+				t.Errorf("origin allowed = %t; want %t", allowed, tt.wantAllowed)
+			}
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name     string
+		header   string
+		wantEcho bool
+	}{
+		{"valid", "abc-123_DEF.4", true},
+		{"missing", "", false},
+		{"invalid characters", "abc 123<script>", false},
+		{"too long", strings.Repeat("a", 65), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = app.contextGetRequestID(r)
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Request-ID", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			app.requestID(next).ServeHTTP(rr, r)
+
+			got := rr.Header().Get("X-Request-ID")
+			if got != seen {
+				t.Errorf("response ID = %q; context ID = %q", got, seen)
+			}
+			if tt.wantEcho && got != tt.header {
+				t.Errorf("ID = %q; want %q", got, tt.header)
+			}
+			if !tt.wantEcho && (got == tt.header || !isUUID(got)) {
+				t.Errorf("ID = %q; want a generated UUID", got)
+			}
+		})
+	}
+}
+
+// isUUID reports whether s has the canonical form of a version 4 UUID.
+func isUUID(s string) bool {
+	if len(s) != 36 || s[14] != '4' {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdef", c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestTrailingSlash(t *testing.T) {
+	tests := []struct {
+		mode         string
+		target       string
+		wantStatus   int
+		wantLocation string
+		wantPath     string
+	}{
+		{"redirect", "/v1/animes/", http.StatusPermanentRedirect, "/v1/animes", ""},
+		{"redirect", "/v1/animes//?page=2", http.StatusPermanentRedirect, "/v1/animes?page=2", ""},
+		{"redirect", "/v1/animes", http.StatusOK, "", "/v1/animes"},
+		{"redirect", "/", http.StatusOK, "", "/"},
+		{"redirect", "//evil.com/", http.StatusNotFound, "", ""},
+		{"redirect", "//v1/animes/", http.StatusPermanentRedirect, "/v1/animes", ""},
+		{"redirect", "/v1/unknown/", http.StatusNotFound, "", ""},
+		{"strip", "/v1/animes/", http.StatusOK, "", "/v1/animes"},
+		{"strip", "/v1/unknown/", http.StatusNotFound, "", ""},
+		{"off", "/v1/animes/", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.target, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.trailingSlash = tt.mode
+
+			var path string
+			router := httprouter.New()
+			router.RedirectTrailingSlash = false
+			router.HandlerFunc(http.MethodGet, "/", func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+			})
+			router.HandlerFunc(http.MethodGet, "/v1/animes", func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+			})
+			rr := httptest.NewRecorder()
+			app.trailingSlash(router).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d; want %d", rr.Code, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q; want %q", got, tt.wantLocation)
+			}
+			if path != tt.wantPath {
+				t.Errorf("handled path = %q; want %q", path, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestTrailingSlashRoutes(t *testing.T) {
+	tests := []struct {
+		target       string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"//evil.com/", http.StatusNotFound, ""},
+		{"/v1/nothing-here/", http.StatusNotFound, ""},
+		{"/v1/healthcheck/", http.StatusPermanentRedirect, "/v1/healthcheck"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.trailingSlash = "redirect"
+			rr := app.serveTest(t, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d", rr.Code, tt.wantStatus)
+			}
+			if got := rr.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q; want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
+
+func TestLimitHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxCount int
+		headers  int
+		status   int
+	}{
+		{"under the limit", 5, 4, http.StatusOK},
+		{"at the limit", 5, 5, http.StatusOK},
+		{"over the limit", 5, 6, http.StatusRequestHeaderFieldsTooLarge},
+		{"no limit", 0, 500, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.headers.maxCount = tt.maxCount
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for i := 0; i < tt.headers; i++ {
+				// Repeated values of one header each count as a field.
+				r.Header.Add("X-Test", "value")
+			}
+			rr := httptest.NewRecorder()
+			app.limitHeaders(http.HandlerFunc(okHandler)).ServeHTTP(rr, r)
+
+			if rr.Code != tt.status {
+				t.Errorf("status = %d; want %d", rr.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	app := newTestApplication(t)
+	limit := routeConcurrency["export"]
+	if limit <= 0 {
+		t.Fatal("no concurrency limit for the export route")
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	blocking := func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}
+	export := app.limitConcurrency("export", blocking)
+	show := app.limitConcurrency("show", okHandler)
+
+	// Fill the export route up to its limit.
+	done := make(chan int, limit)
+	for i := 0; i < limit; i++ {
+		go func() {
+			rr := httptest.NewRecorder()
+			export(rr, httptest.NewRequest(http.MethodGet, "/v1/animes/export", nil))
+			done <- rr.Code
+		}()
+		<-started
+	}
+
+	rr := httptest.NewRecorder()
+	export(rr, httptest.NewRequest(http.MethodGet, "/v1/animes/export", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("export over the limit: status = %d; want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	rr = httptest.NewRecorder()
+	show(rr, httptest.NewRequest(http.MethodGet, "/v1/animes/1", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("show while export is full: status = %d; want %d", rr.Code, http.StatusOK)
+	}
+
+	close(release)
+	for i := 0; i < limit; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("export within the limit: status = %d; want %d", code, http.StatusOK)
+		}
+	}
+
+	// Once the running requests finish the route accepts requests again.
+	go func() { <-started }()
+	rr = httptest.NewRecorder()
+	export(rr, httptest.NewRequest(http.MethodGet, "/v1/animes/export", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("export after release: status = %d; want %d", rr.Code, http.StatusOK)
+	}
+}
+
+// fakeLimiterBackend is a rateLimiterBackend which gives the same answer to every
+// request.
+type fakeLimiterBackend struct {
+	allowed bool
+	err     error
+}
+
+func (b fakeLimiterBackend) allow(ip string) (bool, error) {
+	return b.allowed, b.err
+}
+
+func TestLimitBackendFailure(t *testing.T) {
+	backendErr := errors.New("limiter backend unavailable")
+	tests := []struct {
+		name     string
+		failOpen bool
+		backend  fakeLimiterBackend
+		status   int
+	}{
+		{"fail open", true, fakeLimiterBackend{err: backendErr}, http.StatusOK},
+		{"fail closed", false, fakeLimiterBackend{err: backendErr}, http.StatusServiceUnavailable},
+		{"allowed", false, fakeLimiterBackend{allowed: true}, http.StatusOK},
+		{"limited", true, fakeLimiterBackend{allowed: false}, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.limiter.enabled = true
+			app.config.limiter.failOpen = tt.failOpen
+			var logs bytes.Buffer
+			app.logger = jsonlog.New(&logs, jsonlog.LevelInfo)
+
+			rr := httptest.NewRecorder()
+			app.limit(tt.backend, http.HandlerFunc(okHandler)).ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rr.Code != tt.status {
+				t.Errorf("status = %d; want %d", rr.Code, tt.status)
+			}
+			// Backend errors are logged whichever way the request goes.
+			if logged := strings.Contains(logs.String(), backendErr.Error()); logged != (tt.backend.err != nil) {
+				t.Errorf("error logged = %t; want %t", logged, tt.backend.err != nil)
+			}
+		})
+	}
+}
+
+func TestSensitiveBodyFieldRX(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"name": "Aida", "password": "pa55word"}`, `{"name": "Aida", "password": "[REDACTED]"}`},
+		{`{"Token":"ABC","api_key" : "k"}`, `{"Token":"[REDACTED]","api_key" : "[REDACTED]"}`},
+		{`{"secret": "say \"hi\""}`, `{"secret": "[REDACTED]"}`},
+		// A value cut off by the truncation is still redacted.
+		{`{"password": "pa55w`, `{"password": "[REDACTED]"`},
+		{`{"passwords": "x", "title": "password"}`, `{"passwords": "x", "title": "password"}`},
+		{`{"token": null}`, `{"token": null}`},
+	}
+	for _, tt := range tests {
+		if got := sensitiveBodyFieldRX.ReplaceAllString(tt.body, `${1}"[REDACTED]"`); got != tt.want {
+			t.Errorf("redact(%s) = %s; want %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestTeeBody(t *testing.T) {
+	body := &teeBody{ReadCloser: io.NopCloser(strings.NewReader("0123456789")), limit: 4}
+	got, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "0123456789" {
+		t.Errorf("read %q; want the whole body", got)
+	}
+	if body.buf.String() != "0123" || !body.truncated {
+		t.Errorf("kept %q (truncated: %t); want %q (truncated: true)", body.buf.String(), body.truncated, "0123")
+	}
+}
+
+func TestLogRequestBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		env       string
+		method    string
+		limit     int
+		body      string
+		wantBody  string
+		truncated string
+	}{
+		{"post", "development", http.MethodPost, 64, `{"email":"a@b.kz","password":"pa55word"}`, `{"email":"a@b.kz","password":"[REDACTED]"}`, "false"},
+		{"truncated", "development", http.MethodPut, 20, `{"title":"Akira","year":1988}`, `{"title":"Akira","ye`, "true"},
+		{"truncated secret", "development", http.MethodPost, 20, `{"token":"ABCDEFGHIJKLMNOP"}`, `{"token":"[REDACTED]"`, "true"},
+		{"read request", "development", http.MethodGet, 64, `{}`, "", ""},
+		{"production", "production", http.MethodPost, 64, `{}`, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			app := newTestApplication(t)
+			app.logger = jsonlog.New(&logs, jsonlog.LevelInfo)
+			app.config.env = tt.env
+			app.config.debug.logBodies = true
+			app.config.debug.bodyLogBytes = tt.limit
+
+			var read string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				read = string(b)
+			})
+			app.logRequestBody(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, "/v1/users", strings.NewReader(tt.body)))
+
+			if read != tt.body {
+				t.Errorf("handler read %q; want %q", read, tt.body)
+			}
+			if tt.wantBody == "" {
+				if logs.Len() != 0 {
+					t.Errorf("logged %s; want nothing", logs.String())
+				}
+				return
+			}
+			var entry struct {
+				Message    string            `json:"message"`
+				Properties map[string]string `json:"properties"`
+			}
+			if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+				t.Fatal(err)
+			}
+			if entry.Message != "request body" || entry.Properties["body"] != tt.wantBody || entry.Properties["truncated"] != tt.truncated {
+				t.Errorf("logged %+v; want body %s (truncated: %s)", entry, tt.wantBody, tt.truncated)
+			}
+		})
+	}
+}
+
+func TestAcquireStream(t *testing.T) {
+	app := newTestApplication(t)
+	for i := 0; i < 3; i++ {
+		if _, ok := app.acquireStream(); !ok {
+			t.Fatal("acquireStream() failed without a limit")
+		}
+	}
+
+	app.streams = make(chan struct{}, 2)
+	first, ok := app.acquireStream()
+	if !ok {
+		t.Fatal("first stream refused")
+	}
+	if _, ok := app.acquireStream(); !ok {
+		t.Fatal("second stream refused")
+	}
+	if _, ok := app.acquireStream(); ok {
+		t.Fatal("third stream accepted over the limit of 2")
+	}
+	// Releasing a stream frees its slot for the next one.
+	first()
+	if _, ok := app.acquireStream(); !ok {
+		t.Error("stream refused after a slot was released")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"greenlight.aida.kz/internal/data"
+	"greenlight.aida.kz/internal/validator"
+	"net/http"
+)
+
+func (app *application) rateAnimeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Score int `json:"score"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	rating := &data.Rating{
+		UserID:  app.contextGetUser(r).ID,
+		AnimeID: id,
+		Score:   input.Score,
+	}
+	v := validator.New()
+	if data.ValidateRating(v, rating); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Ratings.Upsert(app.dbContext(r), rating)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrRatingThrottled):
+			app.ratingThrottledResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"rating": rating}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listAnimeRatingsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	ids, err := app.readBulkIDs(w, r, v)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v.Check(len(ids) > 0, "ids", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	summaries, err := app.models.Ratings.AveragesForAnimes(app.dbContext(r), ids)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"ratings": summaries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMyRatingsHandler(w http.ResponseWriter, r *http.Request) {
+	count, err := app.models.Ratings.DeleteAllForUser(app.dbContext(r), app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"deleted": count}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
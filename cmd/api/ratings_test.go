@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"greenlight.aida.kz/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListAnimeRatingsHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		want   string
+	}{
+		{"no query", http.MethodGet, "/v1/animes/ratings", "", "must be provided"},
+		{"empty body", http.MethodPost, "/v1/animes/ratings", `{"ids": []}`, "must be provided"},
+		{"invalid ID", http.MethodGet, "/v1/animes/ratings?ids=1,x", "", "must only contain positive integer IDs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := httptest.NewRecorder()
+			app.listAnimeRatingsHandler(rr, app.newRequest(tt.method, tt.target, tt.body, data.AnonymousUser))
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d; want %d (body: %s)", rr.Code, http.StatusUnprocessableEntity, rr.Body)
+			}
+			if got := decodeErrors(t, rr)["ids"]; got != tt.want {
+				t.Errorf("errors[ids] = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateAnimeHandlerValidation(t *testing.T) {
+	for _, body := range []string{`{"score": 0}`, `{"score": 11}`, `{}`} {
+		t.Run(body, func(t *testing.T) {
+			app := newTestApplication(t)
+			r := app.newRequest(http.MethodPut, "/v1/animes/1/rating", body, &data.User{ID: 1, Activated: true})
+			r = withParams(r, httprouter.Params{{Key: "id", Value: "1"}})
+			rr := httptest.NewRecorder()
+			app.rateAnimeHandler(rr, r)
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+			}
+			if got := decodeErrors(t, rr)["score"]; got != "must be between 1 and 10" {
+				t.Errorf("errors[score] = %q; want %q", got, "must be between 1 and 10")
+			}
+		})
+	}
+}
+
+func TestDeleteMyRatingsRequiresAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+	rr := app.serveTest(t, httptest.NewRequest(http.MethodDelete, "/v1/users/me/ratings", nil))
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
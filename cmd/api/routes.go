@@ -5,25 +5,110 @@ import (
 	"net/http"
 )
 
+type routeRateLimit struct {
+	rps   float64
+	burst int
+}
+
+// routeRateLimits holds the per-route rate limit overrides, keyed by route name.
+// These are applied in addition to the global -limiter-rps and -limiter-burst limits,
+// so they should only ever be stricter. Routes which aren't listed here are limited by
+// the global values alone.
+var routeRateLimits = map[string]routeRateLimit{
+	"search": {rps: 1, burst: 2},
+	"export": {rps: 0.1, burst: 1},
+}
+
+// routeConcurrency holds the maximum number of requests to each route, keyed by route
+// name, which can be handled at the same time. Routes which aren't listed here have
+// no limit.
+var routeConcurrency = map[string]int{
+	"export": 2,
+}
+
+// routeMediaTypes holds the media types which each route can respond with, keyed by
+// route pattern. Routes which aren't listed here only respond with JSON.
+var routeMediaTypes = map[string][]string{
+	"/v1/animes":            {"application/json", "application/x-ndjson"},
+	"/v1/animes/export":     {"application/x-ndjson", "application/gzip"},
+	"/v1/animes/:id/export": {"application/json", "application/yaml", "text/csv"},
+}
+
 func (app *application) routes() http.Handler {
 	router := httprouter.New()
 
 	router.NotFound = http.HandlerFunc(app.notFoundResponse)
 	router.MethodNotAllowed = http.HandlerFunc(app.methodNotAllowedResponse)
+	// Trailing slashes are handled by the trailingSlash() middleware instead. Like
+	// RedirectTrailingSlash it only redirects to paths the router has a route for, but
+	// it uses a 308 redirect (rather than 301 or 307) so that the request method and
+	// body are preserved, and it can also strip the slash without redirecting.
+	router.RedirectTrailingSlash = false
+
+	// The handle() function registers a handler and records the route pattern that it
+	// was registered with, so that middleware can report on requests per route.
+	handle := func(method, pattern string, handler http.HandlerFunc) {
+		router.HandlerFunc(method, pattern, app.route(pattern, handler))
+	}
+	// The dispatch() function registers a route ending in an :id parameter which also
+	// serves fixed path segments (see staticOrID). The static handlers are wrapped in
+	// route() with their own patterns, so only the :id handler is wrapped here; wrapping
+	// the whole dispatcher would check the Accept header against the wrong route.
+	dispatch := func(method, pattern string, static map[string]http.HandlerFunc, handler http.HandlerFunc) {
+		router.HandlerFunc(method, pattern, app.staticOrID(static, app.route(pattern, handler)))
+	}
+
+	handle(http.MethodGet, "/", app.rootHandler)
+	handle(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	handle(http.MethodGet, "/readyz", app.readyzHandler)
+
+	handle(http.MethodGet, "/v1/animes", app.requirePermission("animes:read", app.listAnimesHandler))
+	handle(http.MethodPost, "/v1/animes", app.requirePermission("animes:write", app.createAnimeHandler))
+	dispatch(http.MethodPost, "/v1/animes/:id", map[string]http.HandlerFunc{
+		"batch":    app.route("/v1/animes/batch", app.requirePermission("animes:write", app.createAnimesBatchHandler)),
+		"validate": app.route("/v1/animes/validate", app.requirePermission("animes:write", app.validateAnimeHandler)),
+		"commit":   app.route("/v1/animes/commit", app.requirePermission("animes:write", app.commitAnimeHandler)),
+		"ratings":  app.route("/v1/animes/ratings", app.requirePermission("animes:read", app.listAnimeRatingsHandler)),
+	}, app.notFoundResponse)
+	dispatch(http.MethodGet, "/v1/animes/:id", map[string]http.HandlerFunc{
+		"export":  app.route("/v1/animes/export", app.rateLimitRoute("export", app.requirePermission("animes:read", app.limitConcurrency("export", app.exportAnimesHandler)))),
+		"suggest": app.route("/v1/animes/suggest", app.requirePermission("animes:read", app.suggestHandler)),
+		"ratings": app.route("/v1/animes/ratings", app.requirePermission("animes:read", app.listAnimeRatingsHandler)),
+	}, app.requirePermission("animes:read", app.showAnimeHandler))
+	handle(http.MethodGet, "/v1/animes/:id/export", app.requirePermission("animes:read", app.exportAnimeHandler))
+	handle(http.MethodPatch, "/v1/animes/:id", app.requirePermission("animes:write", app.updateAnimeHandler))
+	handle(http.MethodDelete, "/v1/animes/:id", app.requirePermission("animes:write", app.deleteAnimeHandler))
+	handle(http.MethodPost, "/v1/animes/:id/merge", app.requirePermission("animes:admin", app.mergeAnimeHandler))
+
+	handle(http.MethodPost, "/v1/animes/:id/favorite", app.requireActivatedUser(app.addFavoriteHandler))
+	handle(http.MethodDelete, "/v1/animes/:id/favorite", app.requireActivatedUser(app.removeFavoriteHandler))
+	handle(http.MethodPut, "/v1/animes/:id/rating", app.requireActivatedUser(app.rateAnimeHandler))
+
+	handle(http.MethodGet, "/v1/search", app.rateLimitRoute("search", app.requirePermission("animes:read", app.searchHandler)))
 
-	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
+	handle(http.MethodPost, "/v1/users", app.registerUserHandler)
+	handle(http.MethodGet, "/v1/users", app.requirePermission("users:admin", app.listUsersHandler))
+	handle(http.MethodGet, "/v1/users/me/favorites", app.requireActivatedUser(app.listFavoritesHandler))
+	handle(http.MethodGet, "/v1/users/me/export", app.requireAuthenticatedUser(app.exportMyDataHandler))
+	handle(http.MethodDelete, "/v1/users/me/ratings", app.requireActivatedUser(app.deleteMyRatingsHandler))
+	handle(http.MethodDelete, "/v1/users/me", app.requireAuthenticatedUser(app.deleteMyAccountHandler))
+	dispatch(http.MethodPut, "/v1/users/:id", map[string]http.HandlerFunc{
+		"activated": app.route("/v1/users/activated", app.activateUserHandler),
+	}, app.notFoundResponse)
+	dispatch(http.MethodPost, "/v1/users/:id", map[string]http.HandlerFunc{
+		"lookup": app.route("/v1/users/lookup", app.requirePermission("users:admin", app.listUsersHandler)),
+	}, app.notFoundResponse)
+	handle(http.MethodPut, "/v1/users/:id/roles", app.requirePermission("users:admin", app.assignUserRoleHandler))
+	handle(http.MethodPost, "/v1/users/:id/deactivate", app.requirePermission("users:admin", app.setUserSuspendedHandler(true)))
+	handle(http.MethodPost, "/v1/users/:id/activate", app.requirePermission("users:admin", app.setUserSuspendedHandler(false)))
 
-	router.HandlerFunc(http.MethodGet, "/v1/animes", app.requirePermission("animes:read", app.listAnimesHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/animes", app.requirePermission("animes:write", app.createAnimeHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/animes/:id", app.requirePermission("animes:read", app.showAnimeHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/animes/:id", app.requirePermission("animes:write", app.updateAnimeHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/animes/:id", app.requirePermission("animes:write", app.deleteAnimeHandler))
+	handle(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
 
-	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
-	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	handle(http.MethodGet, "/v1/admin/integrity", app.requirePermission("animes:admin", app.integrityHandler))
+	handle(http.MethodGet, "/v1/admin/validate-catalog", app.requirePermission("animes:admin", app.validateCatalogHandler))
 
-	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	handle(http.MethodGet, "/debug/vars", app.requirePermission("users:admin", app.debugVarsHandler))
 
-	return app.recoverPanic(app.rateLimit(app.authenticate(router)))
+	return app.recordStart(app.metrics(app.recoverPanic(app.requestID(app.queryBudget(app.logRequestBody(app.enforceHTTPS(app.limitHeaders(app.enableCORS(app.rateLimit(app.authenticate(app.cacheControl(app.trailingSlash(router)))))))))))))
 
 }
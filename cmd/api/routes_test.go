@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAcceptNegotiation(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.accept.strict = true
+
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+		want   int
+	}{
+		{"no accept header", "/v1/animes/1", "", http.StatusUnauthorized},
+		{"json on show", "/v1/animes/1", "application/json", http.StatusUnauthorized},
+		{"wildcard on show", "/v1/animes/1", "*/*", http.StatusUnauthorized},
+		{"ndjson on show", "/v1/animes/1", "application/x-ndjson", http.StatusNotAcceptable},
+		{"ndjson on bulk export", "/v1/animes/export", "application/x-ndjson", http.StatusUnauthorized},
+		{"gzip on bulk export", "/v1/animes/export", "application/gzip", http.StatusUnauthorized},
+		{"json on bulk export", "/v1/animes/export", "application/json", http.StatusNotAcceptable},
+		{"csv on single export", "/v1/animes/1/export", "text/csv", http.StatusUnauthorized},
+		{"excluded by quality", "/v1/animes", "application/json;q=0, text/html", http.StatusNotAcceptable},
+		{"ndjson on list", "/v1/animes", "text/html, application/x-ndjson;q=0.5", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			if got := app.serveTest(t, r).Code; got != tt.want {
+				t.Errorf("status = %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAcceptNotStrict(t *testing.T) {
+	app := newTestApplication(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/v1/animes/1", nil)
+	r.Header.Set("Accept", "text/html")
+	if got := app.serveTest(t, r).Code; got != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", got, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"embed"
+	"greenlight.aida.kz/internal/validator"
+	"path"
+	"strings"
+)
+
+//go:embed "schemas"
+var schemaFS embed.FS
+
+// loadSchemas parses all of the embedded JSON Schema files, returning them in a map
+// keyed by file name without the extension (for example "anime_create").
+func loadSchemas() (map[string]*validator.Schema, error) {
+	entries, err := schemaFS.ReadDir("schemas")
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]*validator.Schema, len(entries))
+	for _, entry := range entries {
+		b, err := schemaFS.ReadFile(path.Join("schemas", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		schema, err := validator.ParseSchema(b)
+		if err != nil {
+			return nil, err
+		}
+		schemas[strings.TrimSuffix(entry.Name(), ".json")] = schema
+	}
+	return schemas, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"greenlight.aida.kz/internal/data"
+	"greenlight.aida.kz/internal/validator"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query string
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Query = strings.TrimSpace(app.readString(qs, "q", ""))
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// Search results are always ordered by relevance, so the only permitted sort value
+	// is the default one.
+	input.Filters.Sort = "relevance"
+	input.Filters.SortSafelist = []string{"relevance"}
+
+	v.Check(input.Query != "", "q", "must be provided")
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	results, metadata, err := app.models.Animes.Search(app.dbContext(r), input.Query, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"results": app.presentResults(r, results), "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// presentedResult is a search result whose anime has been through present(). Its
+// match type and relevance are added to the JSON object of the anime.
+type presentedResult struct {
+	anime     any
+	matchType string
+	relevance float64
+}
+
+func (pr presentedResult) MarshalJSON() ([]byte, error) {
+	js, err := json.Marshal(pr.anime)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := json.Marshal(struct {
+		MatchType string  `json:"match_type"`
+		Relevance float64 `json:"relevance"`
+	}{pr.matchType, pr.relevance})
+	if err != nil {
+		return nil, err
+	}
+	if len(js) < 2 || js[0] != '{' {
+		return nil, fmt.Errorf("cannot add search fields to non-object %T", pr.anime)
+	}
+	return extendObject(js, fields), nil
+}
+
+// The presentResults() helper presents the anime of every search result like
+// presentAnimes(), keeping its match type and relevance.
+func (app *application) presentResults(r *http.Request, results []*data.SearchResult) []presentedResult {
+	var permissions data.Permissions
+	if wantLinks(r) {
+		permissions = app.requestPermissions(r)
+	}
+	presented := make([]presentedResult, len(results))
+	for i, result := range results {
+		presented[i] = presentedResult{
+			anime:     app.present(r, result.Anime, permissions),
+			matchType: result.MatchType,
+			relevance: result.Relevance,
+		}
+	}
+	return presented
+}
+
+func (app *application) suggestHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+	q := strings.TrimSpace(app.readString(qs, "q", ""))
+	limit := app.readInt(qs, "limit", app.config.suggest.maxResults, v)
+
+	v.Check(utf8.RuneCountInString(q) >= app.config.suggest.minLength, "q", fmt.Sprintf("must be at least %d characters long", app.config.suggest.minLength))
+	v.Check(limit >= 1 && limit <= app.config.suggest.maxResults, "limit", fmt.Sprintf("must be between 1 and %d", app.config.suggest.maxResults))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	suggestions, err := app.models.Animes.Suggest(app.dbContext(r), q, limit)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, r, http.StatusOK, envelope{"suggestions": suggestions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSearchHandlerValidation(t *testing.T) {
+	app := newTestApplication(t)
+
+	tests := []struct {
+		name  string
+		query string
+		keys  []string
+	}{
+		{"missing query", "", []string{"q"}},
+		{"blank query", "?q=%20%20", []string{"q"}},
+		{"bad page", "?q=naruto&page=0", []string{"page"}},
+		{"bad page size", "?q=naruto&page_size=abc", []string{"page_size"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			app.searchHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/search"+tt.query, nil))
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+			}
+			errs := decodeErrors(t, rr)
+			for _, key := range tt.keys {
+				if _, ok := errs[key]; !ok {
+					t.Errorf("errors = %v; want an error for %q", errs, key)
+				}
+			}
+		})
+	}
+}
+
+func TestSuggestHandlerValidation(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.suggest.minLength = 2
+	app.config.suggest.maxResults = 10
+
+	tests := []struct {
+		name  string
+		query string
+		want  map[string]string
+	}{
+		{"missing query", "", map[string]string{"q": "must be at least 2 characters long"}},
+		{"too short", "?q=n", map[string]string{"q": "must be at least 2 characters long"}},
+		{"too short after trimming", "?q=%20n%20", map[string]string{"q": "must be at least 2 characters long"}},
+		{"one multibyte character", "?q=%E9%AD%94", map[string]string{"q": "must be at least 2 characters long"}},
+		{"limit too large", "?q=na&limit=11", map[string]string{"limit": "must be between 1 and 10"}},
+		{"limit too small", "?q=na&limit=0", map[string]string{"limit": "must be between 1 and 10"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			app.suggestHandler(rr, httptest.NewRequest(http.MethodGet, "/v1/animes/suggest"+tt.query, nil))
+
+			if rr.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("status = %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+			}
+			errs := decodeErrors(t, rr)
+			for key, message := range tt.want {
+				if errs[key] != message {
+					t.Errorf("errors[%q] = %q; want %q", key, errs[key], message)
+				}
+			}
+		})
+	}
+}
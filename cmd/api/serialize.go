@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"greenlight.aida.kz/internal/data"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// serializer describes how to write animes in one of the supported export formats.
+type serializer struct {
+	contentType string
+	extension   string
+	encode      func(w io.Writer, anime *data.Anime) error
+}
+
+// serializers holds the supported export formats, keyed by the value of the format
+// query string parameter.
+var serializers = map[string]serializer{
+	"json": {contentType: "application/json", extension: "json", encode: encodeAnimeJSON},
+	"yaml": {contentType: "application/yaml", extension: "yaml", encode: encodeAnimeYAML},
+	"csv":  {contentType: "text/csv", extension: "csv", encode: encodeAnimeCSV},
+}
+
+func encodeAnimeJSON(w io.Writer, anime *data.Anime) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(anime)
+}
+
+// encodeAnimeYAML writes an anime as a YAML document. Strings are always written in
+// double-quoted form so that titles and genres containing YAML syntax (such as ": "
+// or a leading "-") can't change the structure of the document.
+func encodeAnimeYAML(w io.Writer, anime *data.Anime) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "id: %d\n", anime.ID)
+	fmt.Fprintf(&b, "title: %s\n", strconv.Quote(anime.Title))
+	fmt.Fprintf(&b, "year: %d\n", anime.Year)
+	fmt.Fprintf(&b, "runtime: %s\n", strconv.Quote(fmt.Sprintf("%d mins", anime.Runtime)))
+	if len(anime.Genres) == 0 {
+		b.WriteString("genres: []\n")
+	} else {
+		b.WriteString("genres:\n")
+		for _, genre := range anime.Genres {
+			fmt.Fprintf(&b, "  - %s\n", strconv.Quote(genre))
+		}
+	}
+	fmt.Fprintf(&b, "media_type: %s\n", strconv.Quote(anime.MediaType))
+	if anime.EpisodesCount != nil {
+		fmt.Fprintf(&b, "episodes_count: %d\n", *anime.EpisodesCount)
+	} else {
+		b.WriteString("episodes_count: null\n")
+	}
+	fmt.Fprintf(&b, "status: %s\n", strconv.Quote(anime.Status))
+	fmt.Fprintf(&b, "version: %d\n", anime.Version)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// encodeAnimeCSV writes an anime as a CSV header row followed by a single record.
+// The genres are joined into one field, separated by semicolons.
+func encodeAnimeCSV(w io.Writer, anime *data.Anime) error {
+	episodesCount := ""
+	if anime.EpisodesCount != nil {
+		episodesCount = strconv.Itoa(int(*anime.EpisodesCount))
+	}
+	cw := csv.NewWriter(w)
+	records := [][]string{
+		{"id", "title", "year", "runtime", "genres", "media_type", "episodes_count", "status", "version"},
+		{
+			strconv.FormatInt(anime.ID, 10),
+			anime.Title,
+			strconv.Itoa(int(anime.Year)),
+			strconv.Itoa(int(anime.Runtime)),
+			strings.Join(anime.Genres, ";"),
+			anime.MediaType,
+			episodesCount,
+			anime.Status,
+			strconv.Itoa(int(anime.Version)),
+		},
+	}
+	err := cw.WriteAll(records)
+	if err != nil {
+		return err
+	}
+	return cw.Error()
+}
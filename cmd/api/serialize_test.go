@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"greenlight.aida.kz/internal/data"
+	"reflect"
+	"testing"
+)
+
+// testAnime returns an anime whose title and genres contain characters which are
+// special in YAML and CSV.
+func testAnime() *data.Anime {
+	episodes := int32(12)
+	return &data.Anime{
+		ID:            7,
+		Title:         `Re: Zero - "Starting Life", Again`,
+		Year:          2016,
+		Runtime:       25,
+		Genres:        []string{"Drama", "- Isekai: Dark"},
+		MediaType:     data.MediaTV,
+		EpisodesCount: &episodes,
+		Status:        data.StatusFinished,
+		Version:       2,
+	}
+}
+
+func TestEncodeAnimeJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encodeAnimeJSON(&buf, testAnime()); err != nil {
+		t.Fatal(err)
+	}
+	var got data.Anime
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if got.Title != testAnime().Title || *got.EpisodesCount != 12 {
+		t.Errorf("decoded anime = %+v; want %+v", got, testAnime())
+	}
+}
+
+func TestEncodeAnimeYAML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encodeAnimeYAML(&buf, testAnime()); err != nil {
+		t.Fatal(err)
+	}
+	want := `id: 7
+title: "Re: Zero - \"Starting Life\", Again"
+year: 2016
+runtime: "25 mins"
+genres:
+  - "Drama"
+  - "- Isekai: Dark"
+media_type: "TV"
+episodes_count: 12
+status: "finished"
+version: 2
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestEncodeAnimeYAMLEmptyValues(t *testing.T) {
+	anime := testAnime()
+	anime.Genres = nil
+	anime.EpisodesCount = nil
+
+	var buf bytes.Buffer
+	if err := encodeAnimeYAML(&buf, anime); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"genres: []\n", "episodes_count: null\n"} {
+		if !bytes.Contains(buf.Bytes(), []byte(line)) {
+			t.Errorf("output is missing %q:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestEncodeAnimeCSV(t *testing.T) {
+	var buf bytes.Buffer
+	if err := encodeAnimeCSV(&buf, testAnime()); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v", err)
+	}
+	want := [][]string{
+		{"id", "title", "year", "runtime", "genres", "media_type", "episodes_count", "status", "version"},
+		{"7", `Re: Zero - "Starting Life", Again`, "2016", "25", "Drama;- Isekai: Dark", "TV", "12", "finished", "2"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("records = %q; want %q", records, want)
+	}
+}
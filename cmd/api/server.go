@@ -13,11 +13,12 @@ import (
 
 func (app *application) serve() error {
 	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", app.config.port),
-		Handler:      app.routes(),
-		IdleTimeout:  time.Minute,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		Addr:           fmt.Sprintf(":%d", app.config.port),
+		Handler:        app.routes(),
+		IdleTimeout:    time.Minute,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   30 * time.Second,
+		MaxHeaderBytes: app.config.headers.maxBytes,
 	}
 	// Create a shutdownError channel. We will use this to receive any errors returned
 	// by the graceful Shutdown() function.
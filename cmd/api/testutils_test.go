@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"greenlight.aida.kz/internal/data"
+	"greenlight.aida.kz/internal/jsonlog"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestApplication returns an application with no database, suitable for testing
+// handlers and middleware on paths which don't reach the models.
+func newTestApplication(t *testing.T) *application {
+	t.Helper()
+	var cfg config
+	cfg.env = "development"
+	cfg.errorKey = "error"
+	cfg.root.name = "greenlight"
+	cfg.batch.onDuplicate = data.DuplicatesSkip
+	cfg.batch.maxItems = 100
+	cfg.batch.maxBodyBytes = 1_048_576
+	schemas, err := loadSchemas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &application{
+		config:  cfg,
+		schemas: schemas,
+		logger:  jsonlog.New(io.Discard, jsonlog.LevelFatal),
+	}
+}
+
+// serveTest sends r through the application's full routes() handler chain and returns
+// the recorded response.
+func (app *application) serveTest(t *testing.T, r *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	app.routes().ServeHTTP(rr, r)
+	return rr
+}
+
+// decodeErrors decodes the field errors from a failed validation response.
+func decodeErrors(t *testing.T, rr *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+	var body struct {
+		Error map[string]string `json:"error"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("response is not a validation error: %v (body: %s)", err, rr.Body)
+	}
+	return body.Error
+}
+
+// newRequest returns a request for testing a handler directly, carrying the user
+// which the authenticate() middleware would have added to the context.
+func (app *application) newRequest(method, target, body string, user *data.User) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	return app.contextSetUser(r, user)
+}
+
+// newRefusingDB returns a database whose server refuses every connection, so that
+// every query fails straight away.
+func newRefusingDB(t *testing.T) *data.DB {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	pool, err := pgxpool.New(context.Background(), "postgres://greenlight:pa55word@"+addr+"/greenlight?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return &data.DB{Pool: pool}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"github.com/julienschmidt/httprouter"
+	"greenlight.aida.kz/internal/data"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAssignUserRoleHandlerValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		status int
+	}{
+		{"invalid id", "abc", `{"role": "moderator"}`, http.StatusNotFound},
+		{"missing role", "1", `{}`, http.StatusUnprocessableEntity},
+		{"empty role", "1", `{"role": ""}`, http.StatusUnprocessableEntity},
+		{"unknown field", "1", `{"role": "moderator", "permissions": ["animes:write"]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			r := app.newRequest(http.MethodPut, "/v1/users/"+tt.id+"/roles", tt.body, data.AnonymousUser)
+			r = withParams(r, httprouter.Params{{Key: "id", Value: tt.id}})
+			rr := httptest.NewRecorder()
+			app.assignUserRoleHandler(rr, r)
+
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d; want %d (body: %s)", rr.Code, tt.status, rr.Body)
+			}
+			if tt.status == http.StatusUnprocessableEntity {
+				if got := decodeErrors(t, rr)["role"]; got != "must be provided" {
+					t.Errorf("errors[role] = %q; want %q", got, "must be provided")
+				}
+			}
+		})
+	}
+}
+
+func TestAssignUserRoleRequiresAuthentication(t *testing.T) {
+	app := newTestApplication(t)
+	r := httptest.NewRequest(http.MethodPut, "/v1/users/1/roles", nil)
+	rr := app.serveTest(t, r)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d; want %d", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRegisterUserHandlerDisabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		status  int
+	}{
+		{"disabled", false, http.StatusForbidden},
+		// With registration enabled the invalid user gets as far as validation.
+		{"enabled", true, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApplication(t)
+			app.config.registration.enabled = tt.enabled
+			r := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(`{"name": "", "email": "alice@example.com", "password": "pa55word"}`))
+			rr := app.serveTest(t, r)
+
+			if rr.Code != tt.status {
+				t.Fatalf("status = %d; want %d (body: %s)", rr.Code, tt.status, rr.Body)
+			}
+			if !tt.enabled && !strings.Contains(rr.Body.String(), "user registration is disabled on this server") {
+				t.Errorf("body = %s; want the registration disabled message", rr.Body)
+			}
+		})
+	}
+}
+
+func TestListUsersRequiresAuthentication(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{http.MethodGet, "/v1/users?ids=1,2", ""},
+		{http.MethodPost, "/v1/users/lookup", `{"ids": [1, 2]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := app.serveTest(t, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d; want %d", rr.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestListUsersHandlerValidation(t *testing.T) {
+	app := newTestApplication(t)
+	rr := httptest.NewRecorder()
+	app.listUsersHandler(rr, app.newRequest(http.MethodGet, "/v1/users", "", data.AnonymousUser))
+
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d; want %d", rr.Code, http.StatusUnprocessableEntity)
+	}
+	if got := decodeErrors(t, rr)["ids"]; got != "must be provided" {
+		t.Errorf("errors[ids] = %q; want %q", got, "must be provided")
+	}
+}
+
+func TestMyAccountRoutesRequireAuthentication(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+	}{
+		{http.MethodGet, "/v1/users/me/export"},
+		{http.MethodDelete, "/v1/users/me"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			app := newTestApplication(t)
+			rr := app.serveTest(t, httptest.NewRequest(tt.method, tt.target, nil))
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d; want %d", rr.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// Define the actions which are recorded in the audit log.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+	AuditMerge  = "merge"
+)
+
+// AuditEntry records a change made to a record, and who made it. UserID is nil for
+// changes made by users who have since been deleted.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	UserID     *int64    `json:"user_id"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   int64     `json:"target_id"`
+	RequestID  string    `json:"request_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type AuditModel struct {
+	DB *DB
+}
+
+func (m AuditModel) Insert(ctx context.Context, entry *AuditEntry) error {
+	query := `
+INSERT INTO audit_log (user_id, action, target_type, target_id, request_id)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, created_at`
+	args := []any{entry.UserID, entry.Action, entry.TargetType, entry.TargetID, entry.RequestID}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRow(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// DeleteOlderThan() deletes the audit entries created before t, returning the number
+// of entries which were removed.
+func (m AuditModel) DeleteOlderThan(ctx context.Context, t time.Time) (int64, error) {
+	query := `
+DELETE FROM audit_log
+WHERE created_at < $1`
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	result, err := m.DB.Exec(ctx, query, t)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,34 @@
+package data
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeleteOlderThan(t *testing.T) {
+	pool, srv := newFakePool(t)
+	srv.RespondTag("DELETE FROM audit_log", "DELETE 3")
+	m := AuditModel{DB: &DB{Pool: pool}}
+
+	cutoff := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	count, err := m.DeleteOlderThan(context.Background(), cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("count = %d; want 3", count)
+	}
+	queries := srv.Queries()
+	if len(queries) != 1 {
+		t.Fatalf("got %d queries; want 1", len(queries))
+	}
+	// Only entries created strictly before the cutoff are deleted.
+	if !strings.Contains(queries[0].SQL, "WHERE created_at < $1") {
+		t.Errorf("query = %q; want it to delete entries created before $1", queries[0].SQL)
+	}
+	if want := "2026-01-02 03:04:05Z"; len(queries[0].Args) != 1 || queries[0].Args[0] != want {
+		t.Errorf("args = %q; want [%q]", queries[0].Args, want)
+	}
+}
@@ -0,0 +1,184 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"sort"
+	"time"
+)
+
+// ErrDuplicateAnime is returned by InsertMany() in DuplicatesFail mode when the batch
+// contains duplicate animes.
+var ErrDuplicateAnime = errors.New("duplicate anime")
+
+// Define the modes for handling duplicates in a batch insert. In DuplicatesSkip mode
+// duplicates are left out and the remaining animes inserted, whereas in
+// DuplicatesFail mode nothing is inserted if there are any duplicates at all.
+const (
+	DuplicatesSkip = "skip"
+	DuplicatesFail = "fail"
+)
+
+// ReasonDuplicateInBatch is the reason given for an anime in a batch which duplicates
+// an earlier item. Animes which duplicate an existing record are given the
+// DuplicateTitleMessage() instead.
+const ReasonDuplicateInBatch = "duplicate of an earlier item in the batch"
+
+// BatchConflict describes an anime in a batch which was a duplicate, identified by
+// its position in the batch.
+type BatchConflict struct {
+	Index  int    `json:"index"`
+	Title  string `json:"title"`
+	Year   int32  `json:"year"`
+	Reason string `json:"reason"`
+}
+
+// BatchReport holds the outcome of a batch insert.
+type BatchReport struct {
+	Inserted  []*Anime        `json:"inserted"`
+	Conflicts []BatchConflict `json:"conflicts"`
+}
+
+// InsertMany() inserts a batch of animes in a single transaction. Animes which are
+// duplicates under the TitleScope of an earlier item in the batch, or of an existing
+// record, are reported in the Conflicts field of the returned report. In DuplicatesSkip mode
+// the remaining animes are inserted, while in DuplicatesFail mode nothing is inserted
+// and ErrDuplicateAnime is returned along with the report. The ctx argument should be
+// the request context, so that the transaction can be traced to the request.
+func (m AnimeModel) InsertMany(ctx context.Context, animes []*Anime, mode string) (*BatchReport, error) {
+	report := &BatchReport{
+		Inserted:  []*Anime{},
+		Conflicts: []BatchConflict{},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Rollback is a no-op if the transaction has already been committed.
+	defer tx.Rollback(ctx)
+
+	// Look up which of the animes in the batch already exist.
+	scope := currentTitleScope()
+	titles := make([]string, len(animes))
+	years := make([]int32, len(animes))
+	mediaTypes := make([]string, len(animes))
+	for i, anime := range animes {
+		titles[i] = anime.Title
+		years[i] = anime.Year
+		mediaTypes[i] = anime.MediaType
+	}
+	join := "lower(animes.title) = lower(batch.title)"
+	if scope.year {
+		join += " AND animes.year = batch.year"
+	}
+	if scope.mediaType {
+		join += " AND animes.media_type = batch.media_type"
+	}
+	query := fmt.Sprintf(`
+SELECT DISTINCT lower(animes.title), animes.year, animes.media_type
+FROM animes
+INNER JOIN unnest($1::text[], $2::integer[], $3::text[]) AS batch(title, year, media_type)
+ON %s
+WHERE animes.deleted_at IS NULL`, join)
+	rows, err := tx.Query(ctx, query, titles, years, mediaTypes)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var title, mediaType string
+		var year int32
+		err := rows.Scan(&title, &year, &mediaType)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		existing[scope.key(title, year, mediaType)] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var toInsert []int
+	for i, anime := range animes {
+		key := scope.key(anime.Title, anime.Year, anime.MediaType)
+		switch {
+		case existing[key]:
+			report.Conflicts = append(report.Conflicts, BatchConflict{Index: i, Title: anime.Title, Year: anime.Year, Reason: scope.message})
+		case seen[key]:
+			report.Conflicts = append(report.Conflicts, BatchConflict{Index: i, Title: anime.Title, Year: anime.Year, Reason: ReasonDuplicateInBatch})
+		default:
+			seen[key] = true
+			toInsert = append(toInsert, i)
+		}
+	}
+
+	if mode == DuplicatesFail && len(report.Conflicts) > 0 {
+		return report, ErrDuplicateAnime
+	}
+
+	// An anime with the same title may still be inserted by another request after the
+	// lookup above, so conflicts are also skipped by the insert itself and reported
+	// in the same way as the ones found by the lookup.
+	query = fmt.Sprintf(`
+INSERT INTO animes (title, year, runtime, genres, media_type, episodes_count, status, created_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (%s) WHERE deleted_at IS NULL DO NOTHING
+RETURNING id, created_at, version`, scope.columns())
+	raced := false
+	for _, i := range toInsert {
+		anime := animes[i]
+		args := []any{anime.Title, anime.Year, anime.Runtime, anime.Genres, anime.MediaType, anime.EpisodesCount, anime.Status, anime.CreatedBy}
+		err := tx.QueryRow(ctx, query, args...).Scan(&anime.ID, &anime.CreatedAt, &anime.Version)
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			report.Conflicts = append(report.Conflicts, BatchConflict{Index: i, Title: anime.Title, Year: anime.Year, Reason: scope.message})
+			raced = true
+		case err != nil:
+			return nil, err
+		default:
+			report.Inserted = append(report.Inserted, anime)
+		}
+	}
+	if raced {
+		sort.Slice(report.Conflicts, func(a, b int) bool {
+			return report.Conflicts[a].Index < report.Conflicts[b].Index
+		})
+		if mode == DuplicatesFail {
+			// Nothing is committed, so none of the animes were really inserted.
+			report.Inserted = []*Anime{}
+			return report, ErrDuplicateAnime
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// RefreshSearch() brings the search structures up to date after a bulk insert. New
+// entries in the GIN indexes used for search are first added to a pending list, so
+// this merges the pending lists into the indexes and then updates the planner
+// statistics for the table.
+func (m AnimeModel) RefreshSearch(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	for _, index := range []string{"animes_title_idx", "animes_title_trgm_idx"} {
+		_, err := m.DB.Exec(ctx, "SELECT gin_clean_pending_list($1::regclass)", index)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := m.DB.Exec(ctx, "ANALYZE animes")
+	return err
+}
@@ -0,0 +1,217 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"greenlight.aida.kz/internal/jsonlog"
+	"sync/atomic"
+	"time"
+)
+
+// ErrPoolExhausted is returned when no database connection becomes available within
+// the acquire timeout.
+var ErrPoolExhausted = errors.New("timed out waiting for a database connection")
+
+// DB wraps a pgxpool.Pool so that acquiring a connection from the pool is bounded by
+// AcquireTimeout, independently of the timeout for the query itself. Without this a
+// saturated pool makes every query wait for its whole timeout before failing. A zero
+// AcquireTimeout means that acquiring a connection is bounded only by the query
+// context.
+//
+// If TraceRequestID is set, transactions begun with a context carrying a request ID
+// (see WithRequestID) set the app.request_id setting for their duration, so that the
+// ID can be included in the Postgres logs with log_line_prefix or looked up in
+// pg_stat_activity.
+//
+// Logger, if set, is used by the models to report problems with the data they read.
+type DB struct {
+	*pgxpool.Pool
+	AcquireTimeout time.Duration
+	TraceRequestID bool
+	Logger         *jsonlog.Logger
+}
+
+type requestIDContextKey struct{}
+
+type queryCounterContextKey struct{}
+
+// WithQueryCounter returns a copy of ctx carrying a counter of the queries run with it
+// (or contexts derived from it), along with the counter. Queries are only counted if
+// the pool's connections use a QueryCountTracer.
+func WithQueryCounter(ctx context.Context) (context.Context, *atomic.Int64) {
+	counter := new(atomic.Int64)
+	return context.WithValue(ctx, queryCounterContextKey{}, counter), counter
+}
+
+// QueryCountTracer is a pgx.QueryTracer which increments the query counter in the
+// context of each query, if there is one (see WithQueryCounter).
+type QueryCountTracer struct{}
+
+func (QueryCountTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	if counter, ok := ctx.Value(queryCounterContextKey{}).(*atomic.Int64); ok {
+		counter.Add(1)
+	}
+	return ctx
+}
+
+func (QueryCountTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
+
+// WithRequestID returns a copy of ctx carrying the ID of the request it belongs to.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// Saturation returns the fraction of the pool's maximum number of connections which
+// are currently acquired, between 0 and 1.
+func (db *DB) Saturation() float64 {
+	stat := db.Pool.Stat()
+	if stat.MaxConns() <= 0 {
+		return 0
+	}
+	return float64(stat.AcquiredConns()) / float64(stat.MaxConns())
+}
+
+func (db *DB) acquire(ctx context.Context) (*pgxpool.Conn, error) {
+	if db.AcquireTimeout <= 0 {
+		return db.Pool.Acquire(ctx)
+	}
+	acquireCtx, cancel := context.WithTimeout(ctx, db.AcquireTimeout)
+	defer cancel()
+	conn, err := db.Pool.Acquire(acquireCtx)
+	if err != nil {
+		// Only report the pool as exhausted if it was our acquire deadline that
+		// expired, rather than the caller's context.
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			return nil, ErrPoolExhausted
+		}
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (db *DB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	conn, err := db.acquire(ctx)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	defer conn.Release()
+	return conn.Exec(ctx, sql, args...)
+}
+
+func (db *DB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	conn, err := db.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, sql, args...)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+	return &releasingRows{Rows: rows, conn: conn}, nil
+}
+
+func (db *DB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	conn, err := db.acquire(ctx)
+	if err != nil {
+		return errRow{err: err}
+	}
+	return &releasingRow{row: conn.QueryRow(ctx, sql, args...), conn: conn}
+}
+
+func (db *DB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return db.BeginTx(ctx, pgx.TxOptions{})
+}
+
+func (db *DB) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	conn, err := db.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := conn.BeginTx(ctx, txOptions)
+	if err != nil {
+		conn.Release()
+		return nil, err
+	}
+	if requestID, ok := ctx.Value(requestIDContextKey{}).(string); ok && db.TraceRequestID && requestID != "" {
+		// This is the equivalent of SET LOCAL, which doesn't accept parameters.
+		_, err = tx.Exec(ctx, "SELECT set_config('app.request_id', $1, true)", requestID)
+		if err != nil {
+			tx.Rollback(ctx)
+			conn.Release()
+			return nil, err
+		}
+	}
+	return &releasingTx{Tx: tx, conn: conn}, nil
+}
+
+// releasingRows returns its connection to the pool once the rows are closed, which
+// happens automatically when Next() returns false.
+type releasingRows struct {
+	pgx.Rows
+	conn *pgxpool.Conn
+}
+
+func (rows *releasingRows) Close() {
+	rows.Rows.Close()
+	if rows.conn != nil {
+		rows.conn.Release()
+		rows.conn = nil
+	}
+}
+
+func (rows *releasingRows) Next() bool {
+	if rows.Rows.Next() {
+		return true
+	}
+	rows.Close()
+	return false
+}
+
+// releasingRow returns its connection to the pool once it has been scanned.
+type releasingRow struct {
+	row  pgx.Row
+	conn *pgxpool.Conn
+}
+
+func (row *releasingRow) Scan(dest ...any) error {
+	defer row.conn.Release()
+	return row.row.Scan(dest...)
+}
+
+type errRow struct {
+	err error
+}
+
+func (row errRow) Scan(dest ...any) error {
+	return row.err
+}
+
+// releasingTx returns its connection to the pool once the transaction has been
+// committed or rolled back.
+type releasingTx struct {
+	pgx.Tx
+	conn *pgxpool.Conn
+}
+
+func (tx *releasingTx) Commit(ctx context.Context) error {
+	err := tx.Tx.Commit(ctx)
+	tx.release()
+	return err
+}
+
+func (tx *releasingTx) Rollback(ctx context.Context) error {
+	err := tx.Tx.Rollback(ctx)
+	tx.release()
+	return err
+}
+
+func (tx *releasingTx) release() {
+	if tx.conn != nil {
+		tx.conn.Release()
+		tx.conn = nil
+	}
+}
@@ -0,0 +1,314 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newUnresponsivePool returns a pool whose server accepts connections but never
+// replies, so that acquiring a connection blocks until the context is done.
+func newUnresponsivePool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var conns []net.Conn
+	t.Cleanup(func() {
+		ln.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	cfg, err := pgxpool.ParseConfig("postgres://greenlight:pa55word@" + ln.Addr().String() + "/greenlight?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// fakeQuery is a statement received by a fakeServer, with its text parameters.
+type fakeQuery struct {
+	SQL  string
+	Args []string
+}
+
+// fakeResult is the canned result of a statement run on a fakeServer: the type OIDs of
+// its columns and its rows in text format, or the command tag of a statement which
+// doesn't return rows. As in the text format of COPY, a value of \N stands for NULL.
+type fakeResult struct {
+	match string
+	oids  []uint32
+	rows  [][]string
+	tag   string
+}
+
+// fakeServer speaks just enough of the Postgres protocol to run statements, recording
+// every statement it receives. Statements return no rows unless a result has been
+// set up for them with Respond().
+type fakeServer struct {
+	mu      sync.Mutex
+	queries []fakeQuery
+	results []fakeResult
+}
+
+// newFakePool returns a pool connected to a new fakeServer.
+func newFakePool(t *testing.T) (*pgxpool.Pool, *fakeServer) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	srv := &fakeServer{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+
+	cfg, err := pgxpool.ParseConfig("postgres://greenlight:pa55word@" + ln.Addr().String() + "/greenlight?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Have the parameters sent as text, without describing the statements first.
+	cfg.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool, srv
+}
+
+func (srv *fakeServer) record(sql string, args []string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.queries = append(srv.queries, fakeQuery{SQL: sql, Args: args})
+}
+
+// Respond sets up the result of the statements containing match.
+func (srv *fakeServer) Respond(match string, oids []uint32, rows ...[]string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.results = append(srv.results, fakeResult{match: match, oids: oids, rows: rows})
+}
+
+// RespondTag sets up the command tag returned by the statements containing match,
+// such as "DELETE 3".
+func (srv *fakeServer) RespondTag(match, tag string) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.results = append(srv.results, fakeResult{match: match, tag: tag})
+}
+
+func (srv *fakeServer) result(sql string) fakeResult {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, result := range srv.results {
+		if strings.Contains(sql, result.match) {
+			return result
+		}
+	}
+	return fakeResult{}
+}
+
+// Queries returns the statements received so far.
+func (srv *fakeServer) Queries() []fakeQuery {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return append([]fakeQuery(nil), srv.queries...)
+}
+
+func (srv *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	backend := pgproto3.NewBackend(conn, conn)
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if backend.Flush() != nil {
+		return
+	}
+
+	statements := map[string]string{}
+	// The result of the statement bound to the (unnamed) portal.
+	var result fakeResult
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.Query:
+			srv.record(msg.String, nil)
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("OK")})
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'T'})
+		case *pgproto3.Parse:
+			statements[msg.Name] = msg.Query
+			backend.Send(&pgproto3.ParseComplete{})
+		case *pgproto3.Bind:
+			args := make([]string, len(msg.Parameters))
+			for i, param := range msg.Parameters {
+				args[i] = string(param)
+			}
+			srv.record(statements[msg.PreparedStatement], args)
+			result = srv.result(statements[msg.PreparedStatement])
+			backend.Send(&pgproto3.BindComplete{})
+		case *pgproto3.Describe:
+			if len(result.oids) == 0 {
+				backend.Send(&pgproto3.NoData{})
+				break
+			}
+			fields := make([]pgproto3.FieldDescription, len(result.oids))
+			for i, oid := range result.oids {
+				fields[i] = pgproto3.FieldDescription{Name: []byte(fmt.Sprintf("column%d", i+1)), DataTypeOID: oid, DataTypeSize: -1, TypeModifier: -1}
+			}
+			backend.Send(&pgproto3.RowDescription{Fields: fields})
+		case *pgproto3.Execute:
+			for _, row := range result.rows {
+				values := make([][]byte, len(row))
+				for i, value := range row {
+					if value != `\N` {
+						values[i] = []byte(value)
+					}
+				}
+				backend.Send(&pgproto3.DataRow{Values: values})
+			}
+			tag := result.tag
+			if tag == "" {
+				tag = fmt.Sprintf("SELECT %d", len(result.rows))
+			}
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(tag)})
+		case *pgproto3.Close:
+			backend.Send(&pgproto3.CloseComplete{})
+		case *pgproto3.Sync:
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'T'})
+		case *pgproto3.Terminate:
+			return
+		}
+		if backend.Flush() != nil {
+			return
+		}
+	}
+}
+
+func TestAcquireTimeout(t *testing.T) {
+	db := &DB{Pool: newUnresponsivePool(t), AcquireTimeout: 50 * time.Millisecond}
+
+	start := time.Now()
+	_, err := db.acquire(context.Background())
+	if !errors.Is(err, ErrPoolExhausted) {
+		t.Errorf("err = %v; want %v", err, ErrPoolExhausted)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("acquire took %v; want it bounded by the acquire timeout", elapsed)
+	}
+}
+
+func TestAcquireCallerDeadline(t *testing.T) {
+	db := &DB{Pool: newUnresponsivePool(t), AcquireTimeout: time.Minute}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := db.acquire(ctx)
+	if err == nil || errors.Is(err, ErrPoolExhausted) {
+		t.Errorf("err = %v; want the caller's deadline error rather than %v", err, ErrPoolExhausted)
+	}
+}
+
+func TestBeginTxTracesRequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		trace     bool
+		requestID string
+		want      bool
+	}{
+		{"traced", true, "abc-123", true},
+		{"tracing disabled", false, "abc-123", false},
+		{"no request ID", true, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, srv := newFakePool(t)
+			db := &DB{Pool: pool, TraceRequestID: tt.trace}
+
+			ctx := context.Background()
+			if tt.requestID != "" {
+				ctx = WithRequestID(ctx, tt.requestID)
+			}
+			tx, err := db.Begin(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tx.Rollback(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			traced := false
+			for _, q := range srv.Queries() {
+				if strings.Contains(q.SQL, "set_config('app.request_id'") {
+					traced = true
+					if len(q.Args) != 1 || q.Args[0] != tt.requestID {
+						t.Errorf("set_config args = %q; want [%q]", q.Args, tt.requestID)
+					}
+				}
+			}
+			if traced != tt.want {
+				t.Errorf("request ID traced = %t; want %t (queries: %v)", traced, tt.want, srv.Queries())
+			}
+		})
+	}
+}
+
+func TestSaturation(t *testing.T) {
+	pool, _ := newFakePool(t)
+	db := &DB{Pool: pool}
+
+	if got := db.Saturation(); got != 0 {
+		t.Errorf("idle Saturation() = %v; want 0", got)
+	}
+	conn, err := pool.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	if got, want := db.Saturation(), 1/float64(pool.Stat().MaxConns()); got != want {
+		t.Errorf("Saturation() = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,149 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"time"
+)
+
+// FavoriteEntry describes an anime in a user's favorites.
+type FavoriteEntry struct {
+	AnimeID   int64     `json:"anime_id"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserExport holds all of the data stored about a user.
+type UserExport struct {
+	User      *User            `json:"user"`
+	Favorites []*FavoriteEntry `json:"favorites"`
+	Ratings   []*Rating        `json:"ratings"`
+	Animes    []*Anime         `json:"animes"`
+}
+
+// Export() assembles all of the data stored about a user: their profile, favorites,
+// ratings, and the animes they created. The data is read in a single read-only
+// transaction, so that the sections are consistent with each other. If the user
+// doesn't exist ErrRecordNotFound is returned.
+func (m UserModel) Export(ctx context.Context, userID int64) (*UserExport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	// Rollback is a no-op if the transaction has already been committed.
+	defer tx.Rollback(ctx)
+
+	export := &UserExport{
+		User:      &User{},
+		Favorites: []*FavoriteEntry{},
+		Ratings:   []*Rating{},
+		Animes:    []*Anime{},
+	}
+
+	query := `
+SELECT id, created_at, name, email, activated, suspended, version
+FROM users
+WHERE id = $1`
+	user := export.User
+	err = tx.QueryRow(ctx, query, userID).Scan(&user.ID, &user.CreatedAt, &user.Name, &user.Email, &user.Activated, &user.Suspended, &user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	query = `
+SELECT favorites.anime_id, animes.title, favorites.created_at
+FROM favorites
+INNER JOIN animes ON animes.id = favorites.anime_id
+WHERE favorites.user_id = $1
+ORDER BY favorites.created_at, favorites.anime_id`
+	rows, err := tx.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var favorite FavoriteEntry
+		err := rows.Scan(&favorite.AnimeID, &favorite.Title, &favorite.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Favorites = append(export.Favorites, &favorite)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+SELECT anime_id, score, created_at, updated_at
+FROM ratings
+WHERE user_id = $1
+ORDER BY anime_id`
+	rows, err = tx.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		rating := Rating{UserID: userID}
+		err := rows.Scan(&rating.AnimeID, &rating.Score, &rating.CreatedAt, &rating.UpdatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Ratings = append(export.Ratings, &rating)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+SELECT id, created_at, title, year, runtime, genres, media_type, episodes_count, status, version, deleted_at
+FROM animes
+WHERE created_by = $1
+ORDER BY id`
+	rows, err = tx.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var anime Anime
+		err := rows.Scan(
+			&anime.ID,
+			&anime.CreatedAt,
+			&anime.Title,
+			&anime.Year,
+			&anime.Runtime,
+			&anime.Genres,
+			&anime.MediaType,
+			&anime.EpisodesCount,
+			&anime.Status,
+			&anime.Version,
+			&anime.DeletedAt,
+		)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Animes = append(export.Animes, &anime)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
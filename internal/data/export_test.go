@@ -0,0 +1,72 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgtype"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	pool, srv := newFakePool(t)
+	srv.Respond("FROM users", []uint32{pgtype.Int8OID, pgtype.TimestamptzOID, pgtype.TextOID, pgtype.TextOID, pgtype.BoolOID, pgtype.BoolOID, pgtype.Int4OID},
+		[]string{"7", "2026-01-02 03:04:05+00", "Alice", "alice@example.com", "t", "f", "2"},
+	)
+	srv.Respond("FROM favorites", []uint32{pgtype.Int8OID, pgtype.TextOID, pgtype.TimestamptzOID},
+		[]string{"1", "Mushishi", "2026-01-03 00:00:00+00"},
+	)
+	srv.Respond("FROM ratings", []uint32{pgtype.Int8OID, pgtype.Int4OID, pgtype.TimestamptzOID, pgtype.TimestamptzOID},
+		[]string{"1", "9", "2026-01-04 00:00:00+00", "2026-01-04 00:00:00+00"},
+		[]string{"2", "6", "2026-01-05 00:00:00+00", "2026-01-06 00:00:00+00"},
+	)
+	srv.Respond("WHERE created_by", []uint32{pgtype.Int8OID, pgtype.TimestamptzOID, pgtype.TextOID, pgtype.Int4OID, pgtype.Int4OID,
+		pgtype.TextArrayOID, pgtype.TextOID, pgtype.Int4OID, pgtype.TextOID, pgtype.Int4OID, pgtype.TimestamptzOID},
+		[]string{"2", "2026-01-01 00:00:00+00", "Akira", "1988", "124", "{Sci-Fi}", "Movie", "1", "finished", "1", `\N`},
+	)
+	m := UserModel{DB: &DB{Pool: pool}}
+
+	export, err := m.Export(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.User.ID != 7 || export.User.Name != "Alice" {
+		t.Errorf("user = %+v; want Alice", export.User)
+	}
+	if len(export.Favorites) != 1 || export.Favorites[0].Title != "Mushishi" {
+		t.Errorf("favorites = %v; want Mushishi", export.Favorites)
+	}
+	if len(export.Ratings) != 2 || export.Ratings[1].Score != 6 || export.Ratings[1].UserID != 7 {
+		t.Errorf("ratings = %v; want two ratings by user 7", export.Ratings)
+	}
+	if len(export.Animes) != 1 || export.Animes[0].Title != "Akira" {
+		t.Errorf("animes = %v; want Akira", export.Animes)
+	}
+
+	// Every section is read in the same read-only snapshot.
+	queries := srv.Queries()
+	if len(queries) != 6 {
+		t.Fatalf("got %d queries; want 6", len(queries))
+	}
+	if begin := strings.ToLower(queries[0].SQL); !strings.Contains(begin, "repeatable read") || !strings.Contains(begin, "read only") {
+		t.Errorf("first query = %q; want a read-only repeatable read transaction", queries[0].SQL)
+	}
+	if commit := strings.ToLower(queries[5].SQL); commit != "commit" {
+		t.Errorf("last query = %q; want commit", queries[5].SQL)
+	}
+	for _, q := range queries[1:5] {
+		if len(q.Args) != 1 || q.Args[0] != "7" {
+			t.Errorf("query %q has args %q; want [7]", q.SQL, q.Args)
+		}
+	}
+}
+
+func TestExportUnknownUser(t *testing.T) {
+	pool, _ := newFakePool(t)
+	m := UserModel{DB: &DB{Pool: pool}}
+
+	_, err := m.Export(context.Background(), 7)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Errorf("err = %v; want %v", err, ErrRecordNotFound)
+	}
+}
@@ -0,0 +1,106 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrDuplicateFavorite = errors.New("duplicate favorite")
+
+type FavoriteModel struct {
+	DB *DB
+}
+
+// Add() adds an anime to a user's favorites. It returns ErrDuplicateFavorite if the
+// anime is already a favorite, and ErrRecordNotFound if the anime doesn't exist.
+func (m FavoriteModel) Add(ctx context.Context, userID, animeID int64) error {
+	query := `
+INSERT INTO favorites (user_id, anime_id)
+SELECT $1, id FROM animes WHERE id = $2 AND deleted_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	result, err := m.DB.Exec(ctx, query, userID, animeID)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "favorites_pkey"):
+			return ErrDuplicateFavorite
+		default:
+			return err
+		}
+	}
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Remove() removes an anime from a user's favorites, returning ErrRecordNotFound if
+// it wasn't a favorite.
+func (m FavoriteModel) Remove(ctx context.Context, userID, animeID int64) error {
+	query := `
+DELETE FROM favorites
+WHERE user_id = $1 AND anime_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	result, err := m.DB.Exec(ctx, query, userID, animeID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetAllForUser() returns a page of the animes in a user's favorites.
+func (m FavoriteModel) GetAllForUser(ctx context.Context, userID int64, filters Filters) ([]*Anime, Metadata, error) {
+	query := fmt.Sprintf(`
+SELECT count(*) OVER(), animes.id, animes.created_at, animes.title, animes.year, animes.runtime, animes.genres,
+	animes.media_type, animes.episodes_count, animes.status, animes.version
+FROM favorites
+INNER JOIN animes ON animes.id = favorites.anime_id
+WHERE favorites.user_id = $1 AND animes.deleted_at IS NULL
+ORDER BY %s %s, animes.id ASC
+LIMIT $2 OFFSET $3`, "favorites."+filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	animes := []*Anime{}
+	totalRecords := 0
+	for rows.Next() {
+		var anime Anime
+		err := rows.Scan(
+			&totalRecords,
+			&anime.ID,
+			&anime.CreatedAt,
+			&anime.Title,
+			&anime.Year,
+			&anime.Runtime,
+			&anime.Genres,
+			&anime.MediaType,
+			&anime.EpisodesCount,
+			&anime.Status,
+			&anime.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		capGenres(m.DB, &anime)
+		animes = append(animes, &anime)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return animes, metadata, nil
+}
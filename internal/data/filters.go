@@ -1,11 +1,24 @@
 package data
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"greenlight.aida.kz/internal/validator"
 	"math"
+	"strconv"
 	"strings"
 )
 
+// Define the permitted ranges for the page and page_size query string parameters.
+const (
+	MinPage     = 1
+	MaxPage     = 10_000_000
+	MinPageSize = 1
+	MaxPageSize = 100
+)
+
 type Filters struct {
 	Page         int
 	PageSize     int
@@ -14,15 +27,57 @@ type Filters struct {
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
-	// Check that the page and page_size parameters contain sensible values.
-	v.Check(f.Page > 0, "page", "must be greater than zero")
-	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
-	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
-	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+	// Check that the page and page_size parameters contain sensible values. Each
+	// message names the constraint that was violated along with the allowed range.
+	v.Check(f.Page >= MinPage, "page", rangeMessage("must be a positive integer", MinPage, MaxPage))
+	v.Check(f.Page <= MaxPage, "page", rangeMessage(fmt.Sprintf("must not be greater than %d", MaxPage), MinPage, MaxPage))
+	v.Check(f.PageSize >= MinPageSize, "page_size", rangeMessage("must be a positive integer", MinPageSize, MaxPageSize))
+	v.Check(f.PageSize <= MaxPageSize, "page_size", rangeMessage(fmt.Sprintf("must not be greater than %d", MaxPageSize), MinPageSize, MaxPageSize))
 	// Check that the sort parameter matches a value in the safelist.
 	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
 }
 
+// rangeMessage appends the allowed range for a parameter to a validation message.
+func rangeMessage(message string, min, max int) string {
+	return fmt.Sprintf("%s (allowed range: %d to %d)", message, min, max)
+}
+
+// DefaultSortAliases maps friendly sort values to the sort values they stand for.
+var DefaultSortAliases = map[string]string{
+	"newest":  "-created_at",
+	"oldest":  "created_at",
+	"updated": "-updated_at",
+}
+
+// ParseSortAliases parses a comma-separated list of alias=sort pairs, such as
+// "newest=-created_at,recent=-updated_at", into a sort aliases map.
+func ParseSortAliases(s string) (map[string]string, error) {
+	aliases := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return aliases, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		alias, sort, ok := strings.Cut(pair, "=")
+		alias = strings.TrimSpace(alias)
+		sort = strings.TrimSpace(sort)
+		if !ok || alias == "" || sort == "" {
+			return nil, errors.New("sort aliases must be in the format alias=sort")
+		}
+		aliases[alias] = sort
+	}
+	return aliases, nil
+}
+
+// ResolveSortAlias returns the sort value that sort stands for if it's an alias, or
+// sort unchanged otherwise. The result still needs to be checked against the safelist
+// by ValidateFilters().
+func ResolveSortAlias(sort string, aliases map[string]string) string {
+	if resolved, ok := aliases[sort]; ok {
+		return resolved
+	}
+	return sort
+}
+
 func (f Filters) sortColumn() string {
 	for _, safeValue := range f.SortSafelist {
 		if f.Sort == safeValue {
@@ -56,6 +111,77 @@ type Metadata struct {
 	TotalRecords int `json:"total_records,omitempty"`
 }
 
+// metadataFields lists the default JSON names of the Metadata fields, in the order
+// they're written.
+var metadataFields = []string{"current_page", "page_size", "first_page", "last_page", "total_records"}
+
+// MetadataFieldNames maps the default JSON names of the Metadata fields to the names
+// they're written with. Fields which aren't in the map keep their default name.
+var MetadataFieldNames = map[string]string{}
+
+// ParseMetadataFieldNames parses a comma-separated list of field=name pairs, such as
+// "total_records=total,page_size=per_page", into a field names map.
+func ParseMetadataFieldNames(s string) (map[string]string, error) {
+	names := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return names, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		field, name, ok := strings.Cut(pair, "=")
+		field = strings.TrimSpace(field)
+		name = strings.TrimSpace(name)
+		if !ok || field == "" || name == "" {
+			return nil, errors.New("metadata field names must be in the format field=name")
+		}
+		if !validator.PermittedValue(field, metadataFields...) {
+			return nil, fmt.Errorf("unknown metadata field %q", field)
+		}
+		names[field] = name
+	}
+	// Check that no two fields would be written with the same name.
+	seen := make(map[string]bool)
+	for _, field := range metadataFields {
+		name := field
+		if renamed, ok := names[field]; ok {
+			name = renamed
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate metadata field name %q", name)
+		}
+		seen[name] = true
+	}
+	return names, nil
+}
+
+// MarshalJSON writes the metadata using the names in MetadataFieldNames, omitting
+// zero values as before.
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	values := []int{m.CurrentPage, m.PageSize, m.FirstPage, m.LastPage, m.TotalRecords}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range metadataFields {
+		if values[i] == 0 {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name := field
+		if renamed, ok := MetadataFieldNames[field]; ok {
+			name = renamed
+		}
+		js, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(js)
+		buf.WriteByte(':')
+		buf.WriteString(strconv.Itoa(values[i]))
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
 // The calculateMetadata() function calculates the appropriate pagination metadata
 // values given the total number of records, current page, and page size values. Note
 // that the last page value is calculated using the math.Ceil() function, which rounds
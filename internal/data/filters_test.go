@@ -0,0 +1,203 @@
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"greenlight.aida.kz/internal/validator"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters Filters
+		want    map[string]string
+	}{
+		{
+			name:    "valid",
+			filters: Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}},
+			want:    map[string]string{},
+		},
+		{
+			name:    "page too small",
+			filters: Filters{Page: 0, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}},
+			want:    map[string]string{"page": "must be a positive integer (allowed range: 1 to 10000000)"},
+		},
+		{
+			name:    "page too large",
+			filters: Filters{Page: MaxPage + 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}},
+			want:    map[string]string{"page": "must not be greater than 10000000 (allowed range: 1 to 10000000)"},
+		},
+		{
+			name:    "page size too small",
+			filters: Filters{Page: 1, PageSize: -1, Sort: "id", SortSafelist: []string{"id"}},
+			want:    map[string]string{"page_size": "must be a positive integer (allowed range: 1 to 100)"},
+		},
+		{
+			name:    "page size too large",
+			filters: Filters{Page: 1, PageSize: 101, Sort: "id", SortSafelist: []string{"id"}},
+			want:    map[string]string{"page_size": "must not be greater than 100 (allowed range: 1 to 100)"},
+		},
+		{
+			name:    "both out of range",
+			filters: Filters{Page: 0, PageSize: 0, Sort: "id", SortSafelist: []string{"id"}},
+			want: map[string]string{
+				"page":      "must be a positive integer (allowed range: 1 to 10000000)",
+				"page_size": "must be a positive integer (allowed range: 1 to 100)",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateFilters(v, tt.filters)
+			if len(v.Errors) != len(tt.want) {
+				t.Fatalf("errors = %v; want %v", v.Errors, tt.want)
+			}
+			for key, message := range tt.want {
+				if v.Errors[key] != message {
+					t.Errorf("errors[%q] = %q; want %q", key, v.Errors[key], message)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMetadataFieldNames(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"total_records=total, page_size = per_page", map[string]string{"total_records": "total", "page_size": "per_page"}, false},
+		{"current_page=page_size,page_size=current_page", map[string]string{"current_page": "page_size", "page_size": "current_page"}, false},
+		{"total_records", nil, true},
+		{"total_records=", nil, true},
+		{"=total", nil, true},
+		{"records=total", nil, true},
+		{"current_page=page", nil, false},
+		{"current_page=page_size", nil, true},
+		{"total_records=total,last_page=total", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMetadataFieldNames(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMetadataFieldNames(%q): err = %v; want error: %t", tt.input, err, tt.wantErr)
+			continue
+		}
+		if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseMetadataFieldNames(%q) = %v; want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestMetadataMarshalJSON(t *testing.T) {
+	metadata := calculateMetadata(45, 2, 20)
+	tests := []struct {
+		name     string
+		names    map[string]string
+		metadata Metadata
+		want     string
+	}{
+		{
+			name:     "default names",
+			names:    map[string]string{},
+			metadata: metadata,
+			want:     `{"current_page":2,"page_size":20,"first_page":1,"last_page":3,"total_records":45}`,
+		},
+		{
+			name:     "renamed",
+			names:    map[string]string{"current_page": "page", "page_size": "per_page", "total_records": "total"},
+			metadata: metadata,
+			want:     `{"page":2,"per_page":20,"first_page":1,"last_page":3,"total":45}`,
+		},
+		{
+			name:     "empty",
+			names:    map[string]string{"total_records": "total"},
+			metadata: Metadata{},
+			want:     `{}`,
+		},
+	}
+	saved := MetadataFieldNames
+	defer func() { MetadataFieldNames = saved }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			MetadataFieldNames = tt.names
+			got, err := json.Marshal(tt.metadata)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSortAliases(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"newest=-created_at, recent = -updated_at", map[string]string{"newest": "-created_at", "recent": "-updated_at"}, false},
+		{"newest", nil, true},
+		{"newest=", nil, true},
+		{"=-created_at", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSortAliases(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSortAliases(%q): err = %v; want error: %t", tt.input, err, tt.wantErr)
+			continue
+		}
+		if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSortAliases(%q) = %v; want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSortAliasOrdering(t *testing.T) {
+	safelist := []string{"id", "title", "created_at", "updated_at", "-id", "-title", "-created_at", "-updated_at"}
+	tests := []struct {
+		sort    string
+		orderBy string
+	}{
+		{"newest", "ORDER BY created_at DESC, id ASC"},
+		{"oldest", "ORDER BY created_at ASC, id ASC"},
+		{"updated", "ORDER BY updated_at DESC, id ASC"},
+		{"-title", "ORDER BY title DESC, id ASC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			filters := Filters{Page: 1, PageSize: 20, Sort: ResolveSortAlias(tt.sort, DefaultSortAliases), SortSafelist: safelist}
+			v := validator.New()
+			if ValidateFilters(v, filters); !v.Valid() {
+				t.Fatalf("errors = %v", v.Errors)
+			}
+
+			pool, srv := newFakePool(t)
+			m := AnimeModel{DB: &DB{Pool: pool}}
+			if _, _, err := m.GetAll(context.Background(), AnimeQuery{}, filters); err != nil {
+				t.Fatal(err)
+			}
+			queries := srv.Queries()
+			if len(queries) != 1 || !strings.Contains(queries[0].SQL, tt.orderBy) {
+				t.Errorf("queries = %v; want one ordered with %q", queries, tt.orderBy)
+			}
+		})
+	}
+}
+
+func TestSortAliasNotInSafelist(t *testing.T) {
+	filters := Filters{Page: 1, PageSize: 20, Sort: ResolveSortAlias("updated", DefaultSortAliases), SortSafelist: []string{"id", "-id"}}
+	v := validator.New()
+	ValidateFilters(v, filters)
+	if v.Valid() {
+		t.Error("an alias for a sort outside the safelist was accepted")
+	}
+}
@@ -0,0 +1,102 @@
+package data
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DefaultGenreSynonyms maps common alternative spellings of genres (keyed in lower
+// case) to their canonical form.
+var DefaultGenreSynonyms = map[string]string{
+	"scifi":           "Sci-Fi",
+	"sci fi":          "Sci-Fi",
+	"science fiction": "Sci-Fi",
+	"rom-com":         "Romantic Comedy",
+	"romcom":          "Romantic Comedy",
+	"slice-of-life":   "Slice of Life",
+}
+
+// ParseGenreSynonyms parses a comma-separated list of alias=Canonical pairs, such as
+// "scifi=Sci-Fi,romcom=Romantic Comedy", into a synonyms map.
+func ParseGenreSynonyms(s string) (map[string]string, error) {
+	synonyms := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return synonyms, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		alias, canonical, ok := strings.Cut(pair, "=")
+		alias = strings.TrimSpace(alias)
+		canonical = strings.TrimSpace(canonical)
+		if !ok || alias == "" || canonical == "" {
+			return nil, errors.New("genre synonyms must be in the format alias=Canonical")
+		}
+		synonyms[strings.ToLower(alias)] = canonical
+	}
+	return synonyms, nil
+}
+
+// NormalizeGenres returns a copy of genres with surrounding whitespace removed and
+// any synonyms replaced by their canonical form. Genres with no synonym are left
+// unchanged. A nil slice is returned as nil, so that a missing genres value can still
+// be detected by the validation checks.
+func NormalizeGenres(genres []string, synonyms map[string]string) []string {
+	if genres == nil {
+		return nil
+	}
+	normalized := make([]string, len(genres))
+	for i, genre := range genres {
+		genre = strings.TrimSpace(genre)
+		if canonical, ok := synonyms[strings.ToLower(genre)]; ok {
+			genre = canonical
+		}
+		normalized[i] = genre
+	}
+	return normalized
+}
+
+// ParseGenreInferenceRules parses a comma-separated list of keyword=Genre pairs, such
+// as "school=School,mecha=Mecha", into a map of title keywords (in lower case) to the
+// genre they suggest.
+func ParseGenreInferenceRules(s string) (map[string]string, error) {
+	rules := make(map[string]string)
+	if strings.TrimSpace(s) == "" {
+		return rules, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		keyword, genre, ok := strings.Cut(pair, "=")
+		keyword = titleWords(keyword)
+		genre = strings.TrimSpace(genre)
+		if !ok || keyword == "" || genre == "" {
+			return nil, errors.New("genre inference rules must be in the format keyword=Genre")
+		}
+		rules[keyword] = genre
+	}
+	return rules, nil
+}
+
+// InferGenres returns the genres suggested by rules for an anime with the given
+// title, sorted and without duplicates. A keyword matches when it appears in the title
+// as a whole word (or sequence of words), ignoring case and punctuation.
+func InferGenres(title string, rules map[string]string) []string {
+	words := " " + titleWords(title) + " "
+	seen := make(map[string]bool)
+	var genres []string
+	for keyword, genre := range rules {
+		if strings.Contains(words, " "+keyword+" ") && !seen[genre] {
+			seen[genre] = true
+			genres = append(genres, genre)
+		}
+	}
+	sort.Strings(genres)
+	return genres
+}
+
+// titleWords returns s in lower case with everything but letters and digits collapsed
+// into single spaces.
+func titleWords(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
@@ -0,0 +1,103 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseGenreSynonyms(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"  ", map[string]string{}, false},
+		{"scifi=Sci-Fi", map[string]string{"scifi": "Sci-Fi"}, false},
+		{" SciFi = Sci-Fi , romcom=Romantic Comedy", map[string]string{"scifi": "Sci-Fi", "romcom": "Romantic Comedy"}, false},
+		{"scifi", nil, true},
+		{"=Sci-Fi", nil, true},
+		{"scifi=", nil, true},
+		{"scifi=Sci-Fi,", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseGenreSynonyms(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseGenreSynonyms(%q): err = %v; want error: %t", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseGenreSynonyms(%q) = %v; want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeGenres(t *testing.T) {
+	tests := []struct {
+		genres []string
+		want   []string
+	}{
+		{nil, nil},
+		{[]string{}, []string{}},
+		{[]string{"Action", " Drama "}, []string{"Action", "Drama"}},
+		{[]string{"scifi", "SCI FI", "Science Fiction "}, []string{"Sci-Fi", "Sci-Fi", "Sci-Fi"}},
+		{[]string{"romcom", "Slice-of-Life"}, []string{"Romantic Comedy", "Slice of Life"}},
+		{[]string{"Mecha"}, []string{"Mecha"}},
+	}
+	for _, tt := range tests {
+		if got := NormalizeGenres(tt.genres, DefaultGenreSynonyms); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NormalizeGenres(%q) = %q; want %q", tt.genres, got, tt.want)
+		}
+	}
+}
+
+func TestParseGenreInferenceRules(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"", map[string]string{}, false},
+		{"school=School", map[string]string{"school": "School"}, false},
+		{" Mecha = Mecha , Magical-Girl=Magical Girl", map[string]string{"mecha": "Mecha", "magical girl": "Magical Girl"}, false},
+		{"school", nil, true},
+		{"=School", nil, true},
+		{"!!=School", nil, true},
+		{"school=", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseGenreInferenceRules(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseGenreInferenceRules(%q): err = %v; want error: %t", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseGenreInferenceRules(%q) = %v; want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestInferGenres(t *testing.T) {
+	rules := map[string]string{
+		"school":       "School",
+		"academy":      "School",
+		"mecha":        "Mecha",
+		"magical girl": "Magical Girl",
+	}
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{"Mushishi", nil},
+		{"School Rumble", []string{"School"}},
+		{"Schoolgirl Strikers", nil},
+		{"My Hero Academy: School Days", []string{"School"}},
+		{"MAGICAL-GIRL Mecha!", []string{"Magical Girl", "Mecha"}},
+		{"Magical Mecha Girl", []string{"Mecha"}},
+	}
+	for _, tt := range tests {
+		if got := InferGenres(tt.title, rules); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("InferGenres(%q) = %q; want %q", tt.title, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidIDFormat = errors.New("invalid ID format")
+	ErrStringID        = errors.New("IDs must be JSON numbers, not strings")
+)
+
+// ID is a record ID in a request body.
+type ID int64
+
+// LenientIDs controls how IDs in request bodies are decoded. Normally an ID must be a
+// JSON number, and a string is rejected with ErrStringID. When LenientIDs is true a
+// string holding a whole number, such as "1", is accepted as well.
+var LenientIDs bool
+
+func (id *ID) UnmarshalJSON(jsonValue []byte) error {
+	s := string(jsonValue)
+	if strings.HasPrefix(s, `"`) {
+		if !LenientIDs {
+			return ErrStringID
+		}
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return ErrInvalidIDFormat
+		}
+		s = strings.TrimSpace(unquoted)
+	}
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return ErrInvalidIDFormat
+	}
+	*id = ID(i)
+	return nil
+}
+
+// IDs is a list of record IDs in a request body. Each element is decoded as an ID,
+// and the error for an invalid element says which one it was.
+type IDs []ID
+
+func (ids *IDs) UnmarshalJSON(jsonValue []byte) error {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(jsonValue, &elements); err != nil {
+		return errors.New("IDs must be a JSON array")
+	}
+	list := make(IDs, len(elements))
+	for i, element := range elements {
+		if err := list[i].UnmarshalJSON(element); err != nil {
+			return fmt.Errorf("%w (at index %d)", err, i)
+		}
+	}
+	*ids = list
+	return nil
+}
+
+// Int64s returns the IDs as a []int64, for passing to the models.
+func (ids IDs) Int64s() []int64 {
+	list := make([]int64, len(ids))
+	for i, id := range ids {
+		list[i] = int64(id)
+	}
+	return list
+}
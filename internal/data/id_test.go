@@ -0,0 +1,83 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIDUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		lenient bool
+		want    ID
+		wantErr error
+	}{
+		{`1`, false, 1, nil},
+		{`9223372036854775807`, false, 9223372036854775807, nil},
+		{`-3`, false, -3, nil},
+		{`"1"`, false, 0, ErrStringID},
+		{`"1"`, true, 1, nil},
+		{`" 42 "`, true, 42, nil},
+		{`"abc"`, true, 0, ErrInvalidIDFormat},
+		{`""`, true, 0, ErrInvalidIDFormat},
+		{`1.5`, false, 0, ErrInvalidIDFormat},
+		{`1.5`, true, 0, ErrInvalidIDFormat},
+		{`9223372036854775808`, false, 0, ErrInvalidIDFormat},
+		{`null`, false, 0, ErrInvalidIDFormat},
+		{`true`, true, 0, ErrInvalidIDFormat},
+	}
+	defer func(lenient bool) { LenientIDs = lenient }(LenientIDs)
+	for _, tt := range tests {
+		LenientIDs = tt.lenient
+		var got ID
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("Unmarshal(%s) with lenient=%t: err = %v; want %v", tt.json, tt.lenient, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) with lenient=%t = %d; want %d", tt.json, tt.lenient, got, tt.want)
+		}
+	}
+}
+
+func TestIDsUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		lenient bool
+		want    []int64
+		wantErr error
+		message string
+	}{
+		{json: `[1, 2, 3]`, want: []int64{1, 2, 3}},
+		{json: `[]`, want: []int64{}},
+		{json: `[1, "2"]`, wantErr: ErrStringID, message: "IDs must be JSON numbers, not strings (at index 1)"},
+		{json: `[1, "2"]`, lenient: true, want: []int64{1, 2}},
+		{json: `[1, "x"]`, lenient: true, wantErr: ErrInvalidIDFormat, message: "invalid ID format (at index 1)"},
+		{json: `"1,2"`, lenient: true, message: "IDs must be a JSON array"},
+	}
+	defer func(lenient bool) { LenientIDs = lenient }(LenientIDs)
+	for _, tt := range tests {
+		LenientIDs = tt.lenient
+		var got IDs
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if tt.message != "" {
+			if err == nil || err.Error() != tt.message {
+				t.Errorf("Unmarshal(%s) with lenient=%t: err = %v; want %q", tt.json, tt.lenient, err, tt.message)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Unmarshal(%s) with lenient=%t: err = %v; want it to wrap %v", tt.json, tt.lenient, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unmarshal(%s) with lenient=%t: unexpected error %v", tt.json, tt.lenient, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Int64s(), tt.want) {
+			t.Errorf("Unmarshal(%s) with lenient=%t = %v; want %v", tt.json, tt.lenient, got.Int64s(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"greenlight.aida.kz/internal/validator"
+	"time"
+)
+
+// maxIntegrityIssues is the maximum number of issues listed for each check.
+const maxIntegrityIssues = 100
+
+// integrityChecks holds the consistency checks run by IntegrityModel.Check(). Each
+// query returns one row per issue found, describing the issue.
+var integrityChecks = []struct {
+	name  string
+	query string
+}{
+	{
+		name: "ratings_missing_anime",
+		query: `
+SELECT format('user %s rated missing anime %s', ratings.user_id, ratings.anime_id)
+FROM ratings
+LEFT JOIN animes ON animes.id = ratings.anime_id
+WHERE animes.id IS NULL`,
+	},
+	{
+		name: "ratings_deleted_anime",
+		query: `
+SELECT format('user %s rated deleted anime %s', ratings.user_id, ratings.anime_id)
+FROM ratings
+INNER JOIN animes ON animes.id = ratings.anime_id
+WHERE animes.deleted_at IS NOT NULL`,
+	},
+	{
+		name: "favorites_deleted_anime",
+		query: `
+SELECT format('user %s favorited deleted anime %s', favorites.user_id, favorites.anime_id)
+FROM favorites
+INNER JOIN animes ON animes.id = favorites.anime_id
+WHERE animes.deleted_at IS NOT NULL`,
+	},
+	{
+		name: "duplicate_title_year",
+		query: `
+SELECT format('%s (%s) is shared by animes %s', min(title), year, string_agg(id::text, ', ' ORDER BY id))
+FROM animes
+WHERE deleted_at IS NULL
+GROUP BY lower(title), year
+HAVING count(*) > 1`,
+	},
+	{
+		name: "finished_without_episodes",
+		query: `
+SELECT format('anime %s is finished but has no episodes count', id)
+FROM animes
+WHERE deleted_at IS NULL AND status = 'finished' AND episodes_count IS NULL`,
+	},
+}
+
+// IntegrityCheck holds the outcome of a single consistency check. Count is the total
+// number of issues found, of which at most maxIntegrityIssues are listed in Issues.
+type IntegrityCheck struct {
+	Name   string   `json:"name"`
+	Count  int      `json:"count"`
+	Issues []string `json:"issues"`
+}
+
+// IntegrityReport holds the outcome of every consistency check.
+type IntegrityReport struct {
+	OK     bool             `json:"ok"`
+	Checks []IntegrityCheck `json:"checks"`
+}
+
+type IntegrityModel struct {
+	DB *DB
+}
+
+// Check() runs the consistency checks against the database and reports the issues
+// found by each.
+func (m IntegrityModel) Check(ctx context.Context) (*IntegrityReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	report := &IntegrityReport{OK: true}
+	for _, check := range integrityChecks {
+		query := `
+SELECT count(*) OVER(), issue
+FROM (` + check.query + `) AS issues(issue)
+ORDER BY issue
+LIMIT $1`
+		rows, err := m.DB.Query(ctx, query, maxIntegrityIssues)
+		if err != nil {
+			return nil, err
+		}
+		result := IntegrityCheck{Name: check.name, Issues: []string{}}
+		for rows.Next() {
+			var issue string
+			err := rows.Scan(&result.Count, &issue)
+			if err != nil {
+				rows.Close()
+				return nil, err
+			}
+			result.Issues = append(result.Issues, issue)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		if result.Count > 0 {
+			report.OK = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+	return report, nil
+}
+
+// CatalogIssue describes a stored anime which doesn't pass ValidateAnime().
+type CatalogIssue struct {
+	ID     int64             `json:"id"`
+	Title  string            `json:"title"`
+	Errors map[string]string `json:"errors"`
+}
+
+// ValidateCatalog() runs every stored anime through ValidateAnime(), for finding
+// records which don't pass the current validation rules, and returns a page of the
+// animes which failed in ID order.
+func (m AnimeModel) ValidateCatalog(ctx context.Context, filters Filters) ([]*CatalogIssue, Metadata, error) {
+	issues := []*CatalogIssue{}
+	totalRecords := 0
+	err := m.StreamAll(ctx, func(anime *Anime) error {
+		v := validator.New()
+		if ValidateAnime(v, anime); v.Valid() {
+			return nil
+		}
+		totalRecords++
+		if totalRecords > filters.offset() && len(issues) < filters.limit() {
+			issues = append(issues, &CatalogIssue{ID: anime.ID, Title: anime.Title, Errors: v.Errors})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return issues, metadata, nil
+}
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5/pgtype"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIntegrityCheck(t *testing.T) {
+	oids := []uint32{pgtype.Int8OID, pgtype.TextOID}
+	tests := []struct {
+		name   string
+		seed   func(srv *fakeServer)
+		wantOK bool
+		want   map[string]IntegrityCheck
+	}{
+		{
+			name:   "consistent",
+			seed:   func(srv *fakeServer) {},
+			wantOK: true,
+		},
+		{
+			name: "inconsistent",
+			seed: func(srv *fakeServer) {
+				srv.Respond("rated missing anime", oids,
+					[]string{"2", "user 1 rated missing anime 9"},
+					[]string{"2", "user 3 rated missing anime 9"},
+				)
+				// The count covers the issues beyond the listed ones too.
+				srv.Respond("is shared by animes", oids,
+					[]string{"150", "Akira (1988) is shared by animes 1, 4"},
+				)
+			},
+			wantOK: false,
+			want: map[string]IntegrityCheck{
+				"ratings_missing_anime": {Name: "ratings_missing_anime", Count: 2, Issues: []string{"user 1 rated missing anime 9", "user 3 rated missing anime 9"}},
+				"duplicate_title_year":  {Name: "duplicate_title_year", Count: 150, Issues: []string{"Akira (1988) is shared by animes 1, 4"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, srv := newFakePool(t)
+			tt.seed(srv)
+			m := IntegrityModel{DB: &DB{Pool: pool}}
+
+			report, err := m.Check(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.OK != tt.wantOK {
+				t.Errorf("OK = %t; want %t", report.OK, tt.wantOK)
+			}
+			if len(report.Checks) != len(integrityChecks) {
+				t.Fatalf("got %d checks; want %d", len(report.Checks), len(integrityChecks))
+			}
+			for _, check := range report.Checks {
+				want, ok := tt.want[check.Name]
+				if !ok {
+					want = IntegrityCheck{Name: check.Name, Issues: []string{}}
+				}
+				if !reflect.DeepEqual(check, want) {
+					t.Errorf("check = %+v; want %+v", check, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateCatalog(t *testing.T) {
+	pool, srv := newFakePool(t)
+	oids := []uint32{pgtype.Int8OID, pgtype.TimestamptzOID, pgtype.TextOID, pgtype.Int4OID, pgtype.Int4OID,
+		pgtype.TextArrayOID, pgtype.TextOID, pgtype.Int4OID, pgtype.TextOID, pgtype.Int4OID}
+	srv.Respond("FROM animes", oids,
+		[]string{"1", "2026-01-02 03:04:05+00", "Mushishi", "2005", "24", "{Mystery}", "TV", "26", "finished", "1"},
+		[]string{"2", "2026-01-02 03:04:05+00", "Kinema", "1700", "24", "{Drama}", "TV", "12", "finished", "1"},
+		[]string{"3", "2026-01-02 03:04:05+00", "Haibane", "2002", "24", "{Drama}", "TV", `\N`, "finished", "1"},
+	)
+	m := AnimeModel{DB: &DB{Pool: pool}}
+
+	// With one issue per page, the second page holds the second invalid anime.
+	issues, metadata, err := m.ValidateCatalog(context.Background(), Filters{Page: 2, PageSize: 1, Sort: "id", SortSafelist: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*CatalogIssue{
+		{ID: 3, Title: "Haibane", Errors: map[string]string{"episodes_count": "must be provided for finished animes"}},
+	}
+	if !reflect.DeepEqual(issues, want) {
+		t.Errorf("issues = %+v; want %+v", issues, want)
+	}
+	if metadata.TotalRecords != 2 || metadata.LastPage != 2 {
+		t.Errorf("metadata = %+v; want 2 records over 2 pages", metadata)
+	}
+	if !strings.Contains(srv.Queries()[0].SQL, "deleted_at IS NULL") {
+		t.Errorf("query %q doesn't skip deleted animes", srv.Queries()[0].SQL)
+	}
+}
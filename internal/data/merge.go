@@ -0,0 +1,89 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// MergeReport describes the outcome of merging one anime into another.
+type MergeReport struct {
+	SourceID       int64 `json:"source_id"`
+	TargetID       int64 `json:"target_id"`
+	RatingsMoved   int64 `json:"ratings_moved"`
+	FavoritesMoved int64 `json:"favorites_moved"`
+}
+
+// Merge() merges the source anime into the target anime in a single transaction.
+// The ratings and favorites of the source are moved to the target and the source is
+// soft-deleted. Where a user has rated or favorited both animes their rating or
+// favorite of the target is kept, and the one for the source is dropped. It returns
+// ErrRecordNotFound if either anime doesn't exist. The ctx argument should be the
+// request context, so that the transaction can be traced to the request.
+func (m AnimeModel) Merge(ctx context.Context, sourceID, targetID int64) (*MergeReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Rollback is a no-op if the transaction has already been committed.
+	defer tx.Rollback(ctx)
+
+	// Lock both animes, so that neither can be changed or deleted while the merge is
+	// in progress.
+	query := `
+SELECT count(*) FROM (
+	SELECT id FROM animes
+	WHERE id = ANY($1) AND deleted_at IS NULL
+	FOR UPDATE
+) AS locked`
+	var found int
+	err = tx.QueryRow(ctx, query, []int64{sourceID, targetID}).Scan(&found)
+	if err != nil {
+		return nil, err
+	}
+	if found != 2 {
+		return nil, ErrRecordNotFound
+	}
+
+	report := &MergeReport{SourceID: sourceID, TargetID: targetID}
+	for _, moved := range []struct {
+		table string
+		count *int64
+	}{
+		{"ratings", &report.RatingsMoved},
+		{"favorites", &report.FavoritesMoved},
+	} {
+		_, err := tx.Exec(ctx, `
+DELETE FROM `+moved.table+` AS source
+USING `+moved.table+` AS target
+WHERE source.anime_id = $1 AND target.anime_id = $2 AND source.user_id = target.user_id`, sourceID, targetID)
+		if err != nil {
+			return nil, err
+		}
+		result, err := tx.Exec(ctx, `
+UPDATE `+moved.table+`
+SET anime_id = $2
+WHERE anime_id = $1`, sourceID, targetID)
+		if err != nil {
+			return nil, err
+		}
+		*moved.count = result.RowsAffected()
+	}
+
+	query = `
+UPDATE animes
+SET deleted_at = NOW(), version = version + 1
+WHERE id = $1`
+	_, err = tx.Exec(ctx, query, sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgtype"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	pool, srv := newFakePool(t)
+	srv.Respond("SELECT count(*)", []uint32{pgtype.Int8OID}, []string{"2"})
+	srv.RespondTag("UPDATE ratings", "UPDATE 3")
+	srv.RespondTag("UPDATE favorites", "UPDATE 1")
+	m := AnimeModel{DB: &DB{Pool: pool}}
+
+	report, err := m.Merge(context.Background(), 4, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &MergeReport{SourceID: 4, TargetID: 9, RatingsMoved: 3, FavoritesMoved: 1}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("report = %+v; want %+v", report, want)
+	}
+
+	// The duplicates are dropped before the rest are moved, and the source is only
+	// deleted once everything has been moved off it.
+	var got []string
+	for _, q := range srv.Queries() {
+		got = append(got, strings.Fields(q.SQL)[0]+" "+strings.Join(q.Args, ","))
+	}
+	wantQueries := []string{
+		"begin ",
+		"SELECT {4,9}",
+		"DELETE 4,9",
+		"UPDATE 4,9",
+		"DELETE 4,9",
+		"UPDATE 4,9",
+		"UPDATE 4",
+		"commit ",
+	}
+	if !reflect.DeepEqual(got, wantQueries) {
+		t.Errorf("queries = %q; want %q", got, wantQueries)
+	}
+}
+
+func TestMergeMissingAnime(t *testing.T) {
+	pool, srv := newFakePool(t)
+	srv.Respond("SELECT count(*)", []uint32{pgtype.Int8OID}, []string{"1"})
+	m := AnimeModel{DB: &DB{Pool: pool}}
+
+	_, err := m.Merge(context.Background(), 4, 9)
+	if !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("err = %v; want %v", err, ErrRecordNotFound)
+	}
+	queries := srv.Queries()
+	if last := queries[len(queries)-1].SQL; last != "rollback" {
+		t.Errorf("last query = %q; want rollback", last)
+	}
+}
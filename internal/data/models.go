@@ -2,7 +2,7 @@ package data
 
 import (
 	"errors"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 var (
@@ -12,16 +12,31 @@ var (
 
 type Models struct {
 	Animes      AnimeModel
+	Audit       AuditModel
+	Favorites   FavoriteModel
+	Integrity   IntegrityModel
 	Permissions PermissionModel
+	Ratings     RatingModel
 	Tokens      TokenModel
 	Users       UserModel
 }
 
-func NewModels(db *pgxpool.Pool) Models {
+func NewModels(db *DB) Models {
 	return Models{
 		Animes:      AnimeModel{DB: db},
+		Audit:       AuditModel{DB: db},
+		Favorites:   FavoriteModel{DB: db},
+		Integrity:   IntegrityModel{DB: db},
 		Permissions: PermissionModel{DB: db},
+		Ratings:     RatingModel{DB: db},
 		Tokens:      TokenModel{DB: db},
 		Users:       UserModel{DB: db},
 	}
 }
+
+// isUniqueViolation reports whether err is a PostgreSQL unique_violation error for
+// the named constraint or index.
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == constraint
+}
@@ -0,0 +1,29 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgconn"
+	"testing"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	unique := &pgconn.PgError{Code: "23505", ConstraintName: "animes_title_year_key"}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"matching constraint", unique, true},
+		{"wrapped", fmt.Errorf("inserting anime: %w", unique), true},
+		{"other constraint", &pgconn.PgError{Code: "23505", ConstraintName: "users_email_key"}, false},
+		{"other error code", &pgconn.PgError{Code: "23503", ConstraintName: "animes_title_year_key"}, false},
+		{"not a postgres error", errors.New("duplicate key value violates unique constraint \"animes_title_year_key\""), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := isUniqueViolation(tt.err, "animes_title_year_key"); got != tt.want {
+			t.Errorf("%s: isUniqueViolation() = %t; want %t", tt.name, got, tt.want)
+		}
+	}
+}
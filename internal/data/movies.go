@@ -2,22 +2,109 @@ package data
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5"
 	"greenlight.aida.kz/internal/validator"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Anime struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ID            int64      `json:"id"`
+	CreatedAt     time.Time  `json:"-"`
+	CreatedBy     *int64     `json:"-"`
+	Title         string     `json:"title"`
+	Year          int32      `json:"year,omitempty"`
+	Runtime       Runtime    `json:"runtime,omitempty"`
+	Genres        []string   `json:"genres,omitempty"`
+	MediaType     string     `json:"media_type"`
+	EpisodesCount *int32     `json:"episodes_count"`
+	Status        string     `json:"status"`
+	Version       int32      `json:"version"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Define the permitted values for the MediaType field.
+const (
+	MediaTV      = "TV"
+	MediaMovie   = "Movie"
+	MediaOVA     = "OVA"
+	MediaSpecial = "Special"
+)
+
+// MediaTypes holds the permitted media types, in the order they're listed in error
+// messages.
+var MediaTypes = []string{MediaTV, MediaMovie, MediaOVA, MediaSpecial}
+
+// Define the permitted values for the Status field.
+const (
+	StatusAiring   = "airing"
+	StatusFinished = "finished"
+	StatusUpcoming = "upcoming"
+	// StatusUnknown is given to animes recorded before the status was tracked, and
+	// so is the database default.
+	StatusUnknown = "unknown"
+)
+
+// Statuses holds the permitted statuses, in the order they're listed in error
+// messages.
+var Statuses = []string{StatusAiring, StatusFinished, StatusUpcoming, StatusUnknown}
+
+// explicitAnime mirrors the Anime struct but without the omitempty directives, so
+// that zero-valued fields are rendered as null in the JSON output instead of being
+// dropped from it.
+type explicitAnime struct {
+	ID            int64    `json:"id"`
+	Title         string   `json:"title"`
+	Year          *int32   `json:"year"`
+	Runtime       *Runtime `json:"runtime"`
+	Genres        []string `json:"genres"`
+	MediaType     string   `json:"media_type"`
+	EpisodesCount *int32   `json:"episodes_count"`
+	Status        string   `json:"status"`
+	Version       int32    `json:"version"`
+}
+
+// ExplicitNulls returns a representation of the anime which always includes the
+// year, runtime and genres keys when marshaled, using null for any zero values.
+func (anime *Anime) ExplicitNulls() any {
+	aux := explicitAnime{
+		ID:            anime.ID,
+		Title:         anime.Title,
+		Genres:        anime.Genres,
+		MediaType:     anime.MediaType,
+		EpisodesCount: anime.EpisodesCount,
+		Status:        anime.Status,
+		Version:       anime.Version,
+	}
+	if anime.Year != 0 {
+		aux.Year = &anime.Year
+	}
+	if anime.Runtime != 0 {
+		aux.Runtime = &anime.Runtime
+	}
+	return aux
+}
+
+// strictRuntimeAnime shadows the Runtime field of the embedded Anime with one that
+// doesn't have the omitempty directive. Because it is at a shallower depth, the
+// encoding/json package uses it instead of the embedded field.
+type strictRuntimeAnime struct {
+	*Anime
+	Runtime Runtime `json:"runtime"`
+}
+
+// WithStrictRuntime returns a representation of the anime in which a zero runtime is
+// rendered as null when StrictRuntime is enabled. Otherwise the anime is returned
+// unchanged.
+func (anime *Anime) WithStrictRuntime() any {
+	if !StrictRuntime || anime.Runtime != 0 {
+		return anime
+	}
+	return strictRuntimeAnime{Anime: anime, Runtime: anime.Runtime}
 }
 
 func ValidateAnime(v *validator.Validator, anime *Anime) {
@@ -28,31 +115,207 @@ func ValidateAnime(v *validator.Validator, anime *Anime) {
 	v.Check(anime.Year <= int32(time.Now().Year()), "year", "must not be in the future")
 	v.Check(anime.Runtime != 0, "runtime", "must be provided")
 	v.Check(anime.Runtime > 0, "runtime", "must be a positive integer")
+	if maxRuntime, ok := AnimeLimits.MaxRuntimeByMediaType[anime.MediaType]; ok {
+		v.Check(anime.Runtime <= maxRuntime, "runtime", fmt.Sprintf("must not be more than %d mins for media type %s", maxRuntime, anime.MediaType))
+	} else {
+		v.Check(anime.Runtime <= AnimeLimits.MaxRuntime, "runtime", fmt.Sprintf("must not be more than %d mins", AnimeLimits.MaxRuntime))
+	}
 	v.Check(anime.Genres != nil, "genres", "must be provided")
 	v.Check(len(anime.Genres) >= 1, "genres", "must contain at least 1 genre")
-	v.Check(len(anime.Genres) <= 5, "genres", "must not contain more than 5 genres")
+	v.Check(len(anime.Genres) <= AnimeLimits.MaxGenres, "genres", fmt.Sprintf("must not contain more than %d genres", AnimeLimits.MaxGenres))
 	v.Check(validator.Unique(anime.Genres), "genres", "must not contain duplicate values")
+	// The media type and status are optional, taking their defaults from
+	// SetAnimeDefaults(), so they're only checked when present.
+	if anime.MediaType != "" {
+		v.Check(validator.PermittedValue(anime.MediaType, MediaTypes...), "media_type", "must be one of "+strings.Join(MediaTypes, ", "))
+	}
+	if anime.Status != "" {
+		v.Check(validator.PermittedValue(anime.Status, Statuses...), "status", "must be one of "+strings.Join(Statuses, ", "))
+	}
+	// The episode count may be unknown (null) while a show is airing or upcoming, or
+	// when its status isn't known either, but once it has finished the count must be
+	// known.
+	if anime.EpisodesCount != nil {
+		v.Check(*anime.EpisodesCount > 0, "episodes_count", "must be a positive integer")
+	}
+	if anime.Status == StatusFinished {
+		v.Check(anime.EpisodesCount != nil, "episodes_count", "must be provided for finished animes")
+	}
+	for _, genre := range anime.Genres {
+		v.Check(len(genre) <= AnimeLimits.MaxGenreBytes, "genres", fmt.Sprintf("must not contain genres more than %d bytes long", AnimeLimits.MaxGenreBytes))
+	}
+	// Each genre can be within the limit while the array as a whole is still too
+	// large, so also check the size of the serialized array.
+	v.Check(genresSize(anime.Genres) <= AnimeLimits.MaxGenresTotalBytes, "genres", fmt.Sprintf("must not be more than %d bytes long in total", AnimeLimits.MaxGenresTotalBytes))
+}
+
+// SetAnimeDefaults() fills in the media type and status of a new anime if they were
+// omitted, using the same defaults as the animes table.
+func SetAnimeDefaults(anime *Anime) {
+	if anime.MediaType == "" {
+		anime.MediaType = MediaTV
+	}
+	if anime.Status == "" {
+		anime.Status = StatusUnknown
+	}
+}
+
+// animeFieldDependencies lists the cross-field rules in ValidateAnime(), mapping each
+// field to the other fields which its checks depend on.
+var animeFieldDependencies = map[string][]string{
+	// An episode count must be provided once the status is finished.
+	"episodes_count": {"status"},
+	// The maximum runtime depends on the media type.
+	"runtime": {"media_type"},
+}
+
+// ValidateAnimeFields() checks an anime like ValidateAnime(), but only reports errors
+// for the fields in changed, along with any fields whose cross-field rules depend on
+// a changed field. This lets a partial update succeed even if a field it didn't touch
+// no longer passes validation (for example, after a limit has been lowered).
+func ValidateAnimeFields(v *validator.Validator, anime *Anime, changed map[string]bool) {
+	all := validator.New()
+	ValidateAnime(all, anime)
+	for key, message := range all.Errors {
+		report := changed[key]
+		for _, dependency := range animeFieldDependencies[key] {
+			report = report || changed[dependency]
+		}
+		if report {
+			v.AddError(key, message)
+		}
+	}
+}
+
+// AnimeLimits holds the configurable limits checked by ValidateAnime() and
+// ValidateAnimeQuery(). MaxGenres limits the genres an anime can have, while
+// MaxFilterGenres separately limits the genres a listing can be filtered on. The
+// runtime of an anime is limited by MaxRuntimeByMediaType for its media type, or by
+// MaxRuntime for media types which aren't listed there.
+var AnimeLimits = struct {
+	MaxRuntime            Runtime
+	MaxRuntimeByMediaType map[string]Runtime
+	MaxGenres             int
+	MaxGenreBytes         int
+	MaxGenresTotalBytes   int
+	MaxFilterGenres       int
+	MaxScannedGenres      int
+}{
+	MaxRuntime: 1000,
+	MaxRuntimeByMediaType: map[string]Runtime{
+		MediaMovie:   300,
+		MediaOVA:     200,
+		MediaSpecial: 200,
+	},
+	MaxGenres:           5,
+	MaxGenreBytes:       100,
+	MaxGenresTotalBytes: 1024,
+	MaxFilterGenres:     10,
+	MaxScannedGenres:    50,
+}
+
+// capGenres truncates the genres of an anime read from the database to
+// AnimeLimits.MaxScannedGenres, logging a warning if there were more than that. This
+// guards against a corrupt record producing a huge response.
+func capGenres(db *DB, anime *Anime) {
+	if AnimeLimits.MaxScannedGenres <= 0 || len(anime.Genres) <= AnimeLimits.MaxScannedGenres {
+		return
+	}
+	if db.Logger != nil {
+		db.Logger.PrintWarning("truncated anime genres", map[string]string{
+			"anime_id": strconv.FormatInt(anime.ID, 10),
+			"genres":   strconv.Itoa(len(anime.Genres)),
+			"limit":    strconv.Itoa(AnimeLimits.MaxScannedGenres),
+		})
+	}
+	anime.Genres = anime.Genres[:AnimeLimits.MaxScannedGenres]
+}
+
+// genresSize returns the size in bytes of the genres when serialized as a JSON array.
+func genresSize(genres []string) int {
+	js, err := json.Marshal(genres)
+	if err != nil {
+		return 0
+	}
+	return len(js)
 }
 
 type AnimeModel struct {
-	DB *pgxpool.Pool
+	DB *DB
 }
 
-func (m AnimeModel) Insert(anime *Anime) error {
+func (m AnimeModel) Insert(ctx context.Context, anime *Anime) error {
 
 	query := `
-INSERT INTO animes (title, year, runtime, genres)
-VALUES ($1, $2, $3, $4)
+INSERT INTO animes (title, year, runtime, genres, media_type, episodes_count, status, created_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 RETURNING id, created_at, version`
 
-	args := []any{anime.Title, anime.Year, anime.Runtime, anime.Genres}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	args := []any{anime.Title, anime.Year, anime.Runtime, anime.Genres, anime.MediaType, anime.EpisodesCount, anime.Status, anime.CreatedBy}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRow(ctx, query, args...).Scan(&anime.ID, &anime.CreatedAt, &anime.Version)
+	err := m.DB.QueryRow(ctx, query, args...).Scan(&anime.ID, &anime.CreatedAt, &anime.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, currentTitleScope().index):
+			return ErrDuplicateAnime
+		default:
+			return err
+		}
+	}
+	return nil
 }
 
-func (m AnimeModel) Get(id int64) (*Anime, error) {
+// InsertOrGet() inserts the anime unless one which is a duplicate of it under the
+// TitleScope already exists, in which case the existing record is returned instead.
+// The bool return value is true if a new record was created.
+func (m AnimeModel) InsertOrGet(ctx context.Context, anime *Anime) (*Anime, bool, error) {
+	scope := currentTitleScope()
+	query := fmt.Sprintf(`
+INSERT INTO animes (title, year, runtime, genres, media_type, episodes_count, status, created_by)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (%s) WHERE deleted_at IS NULL DO NOTHING
+RETURNING id, created_at, version`, scope.columns())
+
+	args := []any{anime.Title, anime.Year, anime.Runtime, anime.Genres, anime.MediaType, anime.EpisodesCount, anime.Status, anime.CreatedBy}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRow(ctx, query, args...).Scan(&anime.ID, &anime.CreatedAt, &anime.Version)
+	if err == nil {
+		return anime, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, err
+	}
+
+	// DO NOTHING doesn't return the conflicting row, so fetch it separately.
+	match, matchArgs := scope.match(anime)
+	query = fmt.Sprintf(`
+SELECT id, created_at, title, year, runtime, genres, media_type, episodes_count, status, version
+FROM animes
+WHERE %s AND deleted_at IS NULL`, match)
+	var existing Anime
+	err = m.DB.QueryRow(ctx, query, matchArgs...).Scan(
+		&existing.ID,
+		&existing.CreatedAt,
+		&existing.Title,
+		&existing.Year,
+		&existing.Runtime,
+		&existing.Genres,
+		&existing.MediaType,
+		&existing.EpisodesCount,
+		&existing.Status,
+		&existing.Version,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	return &existing, false, nil
+}
+
+func (m AnimeModel) Get(ctx context.Context, id int64) (*Anime, error) {
 	// The PostgreSQL bigserial type that we're using for the anime ID starts
 	// auto-incrementing at 1 by default, so we know that no animes will have ID values
 	// less than that. To avoid making an unnecessary database call, we take a shortcut
@@ -62,13 +325,13 @@ func (m AnimeModel) Get(id int64) (*Anime, error) {
 	}
 	// Define the SQL query for retrieving the anime data.
 	query := `
-SELECT id, created_at, title, year, runtime, genres, version
+SELECT id, created_at, title, year, runtime, genres, media_type, episodes_count, status, version
 FROM animes
-WHERE id = $1`
+WHERE id = $1 AND deleted_at IS NULL`
 	// Declare a Anime struct to hold the data returned by the query.
 	var anime Anime
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	// Importantly, use defer to make sure that we cancel the context before the Get()
 	// method returns.
 	defer cancel()
@@ -80,14 +343,17 @@ WHERE id = $1`
 		&anime.Year,
 		&anime.Runtime,
 		&anime.Genres,
+		&anime.MediaType,
+		&anime.EpisodesCount,
+		&anime.Status,
 		&anime.Version,
 	)
 	// Handle any errors. If there was no matching anime found, Scan() will return
-	// a sql.ErrNoRows error. We check for this and return our custom ErrRecordNotFound
+	// a pgx.ErrNoRows error. We check for this and return our custom ErrRecordNotFound
 	// error instead.
 	if err != nil {
 		switch {
-		case errors.Is(err, sql.ErrNoRows):
+		case errors.Is(err, pgx.ErrNoRows):
 			return nil, ErrRecordNotFound
 		default:
 			return nil, err
@@ -97,25 +363,27 @@ WHERE id = $1`
 	return &anime, nil
 }
 
-func (m AnimeModel) Update(anime *Anime) error {
-	// Add the 'AND version = $6' clause to the SQL query.
+func (m AnimeModel) Update(ctx context.Context, anime *Anime) error {
+	// Add the 'AND version = $9' clause to the SQL query.
 	query := `
-SELECT id, created_at, title, year, runtime, genres, version
-FROM animes
-WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
-AND (genres @> $2 OR $2 = '{}')
-ORDER BY id`
+UPDATE animes
+SET title = $1, year = $2, runtime = $3, genres = $4, media_type = $5, episodes_count = $6, status = $7, version = version + 1, updated_at = NOW()
+WHERE id = $8 AND version = $9 AND deleted_at IS NULL
+RETURNING version`
 
 	args := []any{
 		anime.Title,
 		anime.Year,
 		anime.Runtime,
 		anime.Genres,
+		anime.MediaType,
+		anime.EpisodesCount,
+		anime.Status,
 		anime.ID,
 		anime.Version, // Add the expected anime version.
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
 	// Execute the SQL query. If no matching row could be found, we know the anime
@@ -124,7 +392,9 @@ ORDER BY id`
 	err := m.DB.QueryRow(ctx, query, args...).Scan(&anime.Version)
 	if err != nil {
 		switch {
-		case errors.Is(err, sql.ErrNoRows):
+		case isUniqueViolation(err, currentTitleScope().index):
+			return ErrDuplicateAnime
+		case errors.Is(err, pgx.ErrNoRows):
 			return ErrEditConflict
 		default:
 			return err
@@ -133,16 +403,19 @@ ORDER BY id`
 	return nil
 }
 
-func (m AnimeModel) Delete(id int64) error {
+func (m AnimeModel) Delete(ctx context.Context, id int64) error {
 	// Return an ErrRecordNotFound error if the anime ID is less than 1.
 	if id < 1 {
 		return ErrRecordNotFound
 	}
-	// Construct the SQL query to delete the record.
+	// Construct the SQL query to soft delete the record. Deleted records are kept so
+	// that they can still be seen by admins, but they're excluded from every other
+	// query.
 	query := `
-DELETE FROM animes
-WHERE id = $1`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+UPDATE animes
+SET deleted_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL`
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 	// Execute the SQL query using the Exec() method, passing in the id variable as
 	// the value for the placeholder parameter. The Exec() method returns a sql.Result
@@ -166,31 +439,76 @@ WHERE id = $1`
 	return nil
 }
 
-func (m AnimeModel) GetAll(title string, genres []string, filters Filters) ([]*Anime, Metadata, error) {
+// AnimeQuery holds the filters for GetAll(). The zero value of each field matches
+// every anime.
+type AnimeQuery struct {
+	Title     string
+	Genres    []string
+	MediaType string
+	Status    string
+	// IncludeDeleted includes soft-deleted animes, with their DeletedAt field set, in
+	// the results.
+	IncludeDeleted bool
+}
+
+// ValidateAnimeQuery() checks the filters for an anime listing.
+func ValidateAnimeQuery(v *validator.Validator, q AnimeQuery) {
+	v.Check(len(q.Genres) <= AnimeLimits.MaxFilterGenres, "genres", fmt.Sprintf("must not filter on more than %d genres", AnimeLimits.MaxFilterGenres))
+}
+
+func (m AnimeModel) GetAll(ctx context.Context, q AnimeQuery, filters Filters) ([]*Anime, Metadata, error) {
+	// Initialize an empty slice to hold the anime data.
+	animes := []*Anime{}
+	metadata, err := m.GetAllFunc(ctx, q, filters, func(anime *Anime) error {
+		// Add the Anime struct to the slice.
+		animes = append(animes, anime)
+		return nil
+	})
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	// If everything went OK, then return the slice of animes.
+	return animes, metadata, nil
+}
+
+// GetAllFunc() is like GetAll(), but calls fn for each anime as it's read from the
+// result set instead of collecting them in a slice, so that the results can be
+// streamed. If fn returns an error the iteration stops and that error is returned.
+func (m AnimeModel) GetAllFunc(ctx context.Context, q AnimeQuery, filters Filters, fn func(anime *Anime) error) (Metadata, error) {
+	if q.Genres == nil {
+		q.Genres = []string{}
+	}
+	// Sorting by relevance orders the animes by how well their titles match the title
+	// query.
+	orderBy := filters.sortColumn()
+	if orderBy == "relevance" {
+		orderBy = "ts_rank(to_tsvector('simple', title), plainto_tsquery('simple', $1))"
+	}
 	// Construct the SQL query to retrieve all anime records.
 	query := fmt.Sprintf(`
-SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, version
+SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, media_type, episodes_count, status, version, deleted_at
 FROM animes
 WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 AND (genres @> $2 OR $2 = '{}')
+AND (media_type = $3 OR $3 = '')
+AND (status = $4 OR $4 = '')
+AND (deleted_at IS NULL OR $5)
 ORDER BY %s %s, id ASC
-LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+LIMIT $6 OFFSET $7`, orderBy, filters.sortDirection())
 
 	// Create a context with a 3-second timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
-	args := []any{title, genres, filters.limit(), filters.offset()}
+	args := []any{q.Title, q.Genres, q.MediaType, q.Status, q.IncludeDeleted, filters.limit(), filters.offset()}
 	// Use QueryContext() to execute the query. This returns a sql.Rows resultset
 	// containing the result.
 	rows, err := m.DB.Query(ctx, query, args...)
 	if err != nil {
-		return nil, Metadata{}, err
+		return Metadata{}, err
 	}
 
 	defer rows.Close()
-	// Initialize an empty slice to hold the anime data.
-	animes := []*Anime{}
 	totalRecords := 0
 	// Use rows.Next to iterate through the rows in the resultset.
 	for rows.Next() {
@@ -206,22 +524,209 @@ LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
 			&anime.Year,
 			&anime.Runtime,
 			&anime.Genres,
+			&anime.MediaType,
+			&anime.EpisodesCount,
+			&anime.Status,
 			&anime.Version,
+			&anime.DeletedAt,
 		)
 		if err != nil {
-			return nil, Metadata{}, err
+			return Metadata{}, err
+		}
+		capGenres(m.DB, &anime)
+		err = fn(&anime)
+		if err != nil {
+			return Metadata{}, err
 		}
-		// Add the Anime struct to the slice.
-		animes = append(animes, &anime)
 	}
 	// When the rows.Next() loop has finished, call rows.Err() to retrieve any error
 	// that was encountered during the iteration.
+	if err = rows.Err(); err != nil {
+		return Metadata{}, err
+	}
+
+	return calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Define constants for the reasons a search result can match on.
+const (
+	MatchTitle = "title"
+	MatchGenre = "genre"
+	MatchBoth  = "both"
+)
+
+// Suggestion is a lightweight anime returned by Suggest().
+type Suggestion struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+// Suggest() returns up to limit animes whose title starts with q, followed by those
+// whose title is similar to it (using trigram similarity), for type-ahead search.
+// Prefix matches come first, then the suggestions are ordered by similarity.
+func (m AnimeModel) Suggest(ctx context.Context, q string, limit int) ([]*Suggestion, error) {
+	query := `
+SELECT id, title
+FROM animes
+WHERE deleted_at IS NULL
+AND (lower(title) LIKE $2 OR lower(title) % lower($1))
+ORDER BY lower(title) LIKE $2 DESC, similarity(lower(title), lower($1)) DESC, title ASC, id ASC
+LIMIT $3`
+
+	// Escape the LIKE wildcards in the query so that they're matched literally.
+	prefix := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(q)) + "%"
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, q, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*Suggestion{}
+	for rows.Next() {
+		var suggestion Suggestion
+		err := rows.Scan(&suggestion.ID, &suggestion.Title)
+		if err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, &suggestion)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+// SearchResult wraps an anime returned by Search() together with the reason it
+// matched the query and its relevance score.
+type SearchResult struct {
+	*Anime
+	MatchType string  `json:"match_type"`
+	Relevance float64 `json:"relevance"`
+}
+
+// Search() finds animes whose title matches the query (using full-text search) or
+// which have a genre matching the query or one of its words. The results are ordered
+// by a combined relevance score, where title matches are ranked using ts_rank and
+// each matching genre adds a fixed weight.
+func (m AnimeModel) Search(ctx context.Context, q string, filters Filters) ([]*SearchResult, Metadata, error) {
+	query := `
+WITH scored AS (
+	SELECT id, created_at, title, year, runtime, genres, media_type, episodes_count, status, version,
+		to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) AS title_match,
+		ts_rank(to_tsvector('simple', title), plainto_tsquery('simple', $1)) AS title_rank,
+		(SELECT count(*) FROM unnest(genres) AS g
+			WHERE lower(g) = lower($1)
+			OR lower(g) = ANY(regexp_split_to_array(lower($1), '\s+'))) AS genre_hits
+	FROM animes
+	WHERE deleted_at IS NULL
+)
+SELECT count(*) OVER(), id, created_at, title, year, runtime, genres, media_type, episodes_count, status, version,
+	title_match, genre_hits > 0, (title_rank + 0.5 * genre_hits)::float8
+FROM scored
+WHERE title_match OR genre_hits > 0
+ORDER BY 14 DESC, id ASC
+LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, q, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	results := []*SearchResult{}
+	totalRecords := 0
+	for rows.Next() {
+		var anime Anime
+		var titleMatch, genreMatch bool
+		result := SearchResult{Anime: &anime}
+		err := rows.Scan(
+			&totalRecords,
+			&anime.ID,
+			&anime.CreatedAt,
+			&anime.Title,
+			&anime.Year,
+			&anime.Runtime,
+			&anime.Genres,
+			&anime.MediaType,
+			&anime.EpisodesCount,
+			&anime.Status,
+			&anime.Version,
+			&titleMatch,
+			&genreMatch,
+			&result.Relevance,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		switch {
+		case titleMatch && genreMatch:
+			result.MatchType = MatchBoth
+		case titleMatch:
+			result.MatchType = MatchTitle
+		default:
+			result.MatchType = MatchGenre
+		}
+		capGenres(m.DB, &anime)
+		results = append(results, &result)
+	}
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
 
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
-	// If everything went OK, then return the slice of animes.
-	return animes, metadata, nil
+	return results, metadata, nil
+}
 
+// StreamAll() iterates over every anime in the database in ID order, calling fn for
+// each record as it is read from the result set. This keeps memory usage flat
+// regardless of the size of the catalog. If fn returns an error the iteration stops
+// and that error is returned.
+func (m AnimeModel) StreamAll(ctx context.Context, fn func(anime *Anime) error) error {
+	query := `
+SELECT id, created_at, title, year, runtime, genres, media_type, episodes_count, status, version
+FROM animes
+WHERE deleted_at IS NULL
+ORDER BY id ASC`
+
+	// Streaming the whole catalog can take much longer than a normal query, so we use
+	// a timeout in line with the server's write timeout.
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var anime Anime
+		err := rows.Scan(
+			&anime.ID,
+			&anime.CreatedAt,
+			&anime.Title,
+			&anime.Year,
+			&anime.Runtime,
+			&anime.Genres,
+			&anime.MediaType,
+			&anime.EpisodesCount,
+			&anime.Status,
+			&anime.Version,
+		)
+		if err != nil {
+			return err
+		}
+		err = fn(&anime)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
 }
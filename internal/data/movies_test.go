@@ -0,0 +1,498 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgtype"
+	"greenlight.aida.kz/internal/jsonlog"
+	"greenlight.aida.kz/internal/validator"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnimeExplicitNulls(t *testing.T) {
+	tests := []struct {
+		name  string
+		anime Anime
+		want  string
+	}{
+		{
+			name:  "zero values",
+			anime: Anime{ID: 1, Title: "Mushishi", MediaType: MediaTV, Status: StatusFinished, Version: 1},
+			want:  `{"id":1,"title":"Mushishi","year":null,"runtime":null,"genres":null,"media_type":"TV","episodes_count":null,"status":"finished","version":1}`,
+		},
+		{
+			name:  "all set",
+			anime: Anime{ID: 2, Title: "Akira", Year: 1988, Runtime: 124, Genres: []string{"Sci-Fi"}, MediaType: MediaMovie, Status: StatusFinished, Version: 3},
+			want:  `{"id":2,"title":"Akira","year":1988,"runtime":"124 mins","genres":["Sci-Fi"],"media_type":"Movie","episodes_count":null,"status":"finished","version":3}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.anime.ExplicitNulls())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnimeOmitsZeroValues(t *testing.T) {
+	anime := Anime{ID: 1, Title: "Mushishi", MediaType: MediaTV, Status: StatusFinished, Version: 1}
+	got, err := json.Marshal(&anime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"id":1,"title":"Mushishi","media_type":"TV","episodes_count":null,"status":"finished","version":1}`
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+func TestAnimeWithStrictRuntime(t *testing.T) {
+	tests := []struct {
+		name    string
+		strict  bool
+		runtime Runtime
+		want    string // The raw runtime value, or empty if it should be omitted.
+	}{
+		{"zero", false, 0, ""},
+		{"non-zero", false, 124, `"124 mins"`},
+		{"strict zero", true, 0, "null"},
+		{"strict non-zero", true, 124, `"124 mins"`},
+	}
+	saved := StrictRuntime
+	defer func() { StrictRuntime = saved }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			StrictRuntime = tt.strict
+			anime := Anime{ID: 1, Title: "Akira", Runtime: tt.runtime, MediaType: MediaMovie, Status: StatusFinished, Version: 1}
+			js, err := json.Marshal(anime.WithStrictRuntime())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(js, &fields); err != nil {
+				t.Fatal(err)
+			}
+			got, ok := fields["runtime"]
+			switch {
+			case tt.want == "" && ok:
+				t.Errorf("runtime = %s; want it omitted", got)
+			case tt.want != "" && string(got) != tt.want:
+				t.Errorf("runtime = %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// validAnime returns an anime which passes ValidateAnime().
+func validAnime() *Anime {
+	episodes := int32(26)
+	return &Anime{
+		Title:         "Mushishi",
+		Year:          2005,
+		Runtime:       24,
+		Genres:        []string{"Mystery", "Slice of Life"},
+		MediaType:     MediaTV,
+		EpisodesCount: &episodes,
+		Status:        StatusFinished,
+	}
+}
+
+func TestValidateAnime(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(anime *Anime)
+		want   map[string]string
+	}{
+		{
+			name:   "valid",
+			modify: func(anime *Anime) {},
+			want:   map[string]string{},
+		},
+		{
+			name:   "too many genres",
+			modify: func(anime *Anime) { anime.Genres = []string{"a", "b", "c", "d", "e", "f"} },
+			want:   map[string]string{"genres": "must not contain more than 5 genres"},
+		},
+		{
+			name: "configured genre limit",
+			modify: func(anime *Anime) {
+				anime.Genres = []string{"a", "b", "c"}
+				AnimeLimits.MaxGenres = 2
+			},
+			want: map[string]string{"genres": "must not contain more than 2 genres"},
+		},
+		{
+			name: "body limit is independent of the filter limit",
+			modify: func(anime *Anime) {
+				anime.Genres = []string{"a", "b", "c"}
+				AnimeLimits.MaxFilterGenres = 1
+			},
+			want: map[string]string{},
+		},
+		{
+			name:   "genre too long",
+			modify: func(anime *Anime) { anime.Genres = []string{strings.Repeat("a", 101)} },
+			want:   map[string]string{"genres": "must not contain genres more than 100 bytes long"},
+		},
+		{
+			name:   "genre at the length limit",
+			modify: func(anime *Anime) { anime.Genres = []string{strings.Repeat("a", 100)} },
+			want:   map[string]string{},
+		},
+		{
+			name: "genres too long in total",
+			modify: func(anime *Anime) {
+				anime.Genres = []string{strings.Repeat("a", 100), strings.Repeat("b", 100), strings.Repeat("c", 100), strings.Repeat("d", 100)}
+				AnimeLimits.MaxGenresTotalBytes = 300
+			},
+			want: map[string]string{"genres": "must not be more than 300 bytes long in total"},
+		},
+		{
+			name:   "runtime too long",
+			modify: func(anime *Anime) { anime.Runtime = 1001 },
+			want:   map[string]string{"runtime": "must not be more than 1000 mins"},
+		},
+		{
+			name:   "runtime at the limit",
+			modify: func(anime *Anime) { anime.Runtime = 1000 },
+			want:   map[string]string{},
+		},
+		{
+			name:   "negative runtime",
+			modify: func(anime *Anime) { anime.Runtime = -5 },
+			want:   map[string]string{"runtime": "must be a positive integer"},
+		},
+		{
+			name:   "configured runtime limit",
+			modify: func(anime *Anime) { anime.Runtime = 121; AnimeLimits.MaxRuntime = 120 },
+			want:   map[string]string{"runtime": "must not be more than 120 mins"},
+		},
+		{
+			name:   "omitted media type and status",
+			modify: func(anime *Anime) { anime.MediaType = ""; anime.Status = ""; anime.EpisodesCount = nil },
+			want:   map[string]string{},
+		},
+		{
+			name:   "unknown media type",
+			modify: func(anime *Anime) { anime.MediaType = "tv" },
+			want:   map[string]string{"media_type": "must be one of TV, Movie, OVA, Special"},
+		},
+		{
+			name:   "movie runtime too long",
+			modify: func(anime *Anime) { anime.MediaType = MediaMovie; anime.Runtime = 301 },
+			want:   map[string]string{"runtime": "must not be more than 300 mins for media type Movie"},
+		},
+		{
+			name:   "OVA runtime too long",
+			modify: func(anime *Anime) { anime.MediaType = MediaOVA; anime.Runtime = 201 },
+			want:   map[string]string{"runtime": "must not be more than 200 mins for media type OVA"},
+		},
+		{
+			name:   "TV runtime uses the general limit",
+			modify: func(anime *Anime) { anime.Runtime = 900 },
+			want:   map[string]string{},
+		},
+		{
+			name:   "invalid status",
+			modify: func(anime *Anime) { anime.Status = "cancelled" },
+			want:   map[string]string{"status": "must be one of airing, finished, upcoming, unknown"},
+		},
+		{
+			name:   "finished without an episode count",
+			modify: func(anime *Anime) { anime.EpisodesCount = nil },
+			want:   map[string]string{"episodes_count": "must be provided for finished animes"},
+		},
+		{
+			name:   "airing without an episode count",
+			modify: func(anime *Anime) { anime.EpisodesCount = nil; anime.Status = StatusAiring },
+			want:   map[string]string{},
+		},
+		{
+			name:   "unknown status without an episode count",
+			modify: func(anime *Anime) { anime.EpisodesCount = nil; anime.Status = StatusUnknown },
+			want:   map[string]string{},
+		},
+		{
+			name: "zero episode count",
+			modify: func(anime *Anime) {
+				zero := int32(0)
+				anime.EpisodesCount = &zero
+			},
+			want: map[string]string{"episodes_count": "must be a positive integer"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := AnimeLimits
+			defer func() { AnimeLimits = saved }()
+
+			anime := validAnime()
+			tt.modify(anime)
+			v := validator.New()
+			ValidateAnime(v, anime)
+			if len(v.Errors) != len(tt.want) {
+				t.Fatalf("errors = %v; want %v", v.Errors, tt.want)
+			}
+			for key, message := range tt.want {
+				if v.Errors[key] != message {
+					t.Errorf("errors[%q] = %q; want %q", key, v.Errors[key], message)
+				}
+			}
+		})
+	}
+}
+
+func TestSetAnimeDefaults(t *testing.T) {
+	anime := &Anime{Title: "Akira"}
+	SetAnimeDefaults(anime)
+	if anime.MediaType != MediaTV || anime.Status != StatusUnknown {
+		t.Errorf("media type %q, status %q; want %q, %q", anime.MediaType, anime.Status, MediaTV, StatusUnknown)
+	}
+
+	// Values which were given are kept.
+	anime = &Anime{Title: "Akira", MediaType: MediaMovie, Status: StatusFinished}
+	SetAnimeDefaults(anime)
+	if anime.MediaType != MediaMovie || anime.Status != StatusFinished {
+		t.Errorf("media type %q, status %q; want %q, %q", anime.MediaType, anime.Status, MediaMovie, StatusFinished)
+	}
+}
+
+func TestValidateAnimeFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(anime *Anime)
+		changed []string
+		want    map[string]string
+	}{
+		{
+			name:    "untouched invalid field",
+			modify:  func(anime *Anime) { anime.Runtime = 1001 },
+			changed: []string{"title"},
+			want:    map[string]string{},
+		},
+		{
+			name:    "changed invalid field",
+			modify:  func(anime *Anime) { anime.Title = ""; anime.Runtime = 1001 },
+			changed: []string{"title"},
+			want:    map[string]string{"title": "must be provided"},
+		},
+		{
+			name:    "status makes the episode count required",
+			modify:  func(anime *Anime) { anime.EpisodesCount = nil },
+			changed: []string{"status"},
+			want:    map[string]string{"episodes_count": "must be provided for finished animes"},
+		},
+		{
+			name:    "media type lowers the runtime limit",
+			modify:  func(anime *Anime) { anime.Runtime = 400; anime.MediaType = MediaMovie },
+			changed: []string{"media_type"},
+			want:    map[string]string{"runtime": "must not be more than 300 mins for media type Movie"},
+		},
+		{
+			name:    "nothing changed",
+			modify:  func(anime *Anime) { anime.Title = "" },
+			changed: nil,
+			want:    map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anime := validAnime()
+			tt.modify(anime)
+			changed := make(map[string]bool)
+			for _, field := range tt.changed {
+				changed[field] = true
+			}
+			v := validator.New()
+			ValidateAnimeFields(v, anime, changed)
+			if !reflect.DeepEqual(v.Errors, tt.want) {
+				t.Errorf("errors = %v; want %v", v.Errors, tt.want)
+			}
+		})
+	}
+}
+
+// numberedGenres returns n distinct genres.
+func numberedGenres(n int) []string {
+	genres := make([]string, n)
+	for i := range genres {
+		genres[i] = fmt.Sprintf("genre%d", i)
+	}
+	return genres
+}
+
+func TestValidateAnimeQuery(t *testing.T) {
+	tests := []struct {
+		name            string
+		genres          []string
+		maxGenres       int
+		maxFilterGenres int
+		want            string
+	}{
+		{"no genres", nil, 5, 10, ""},
+		{"more than the body limit", numberedGenres(6), 5, 10, ""},
+		{"at the filter limit", numberedGenres(10), 5, 10, ""},
+		{"over the filter limit", numberedGenres(11), 5, 10, "must not filter on more than 10 genres"},
+		{"configured filter limit", numberedGenres(3), 5, 2, "must not filter on more than 2 genres"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := AnimeLimits
+			defer func() { AnimeLimits = saved }()
+			AnimeLimits.MaxGenres = tt.maxGenres
+			AnimeLimits.MaxFilterGenres = tt.maxFilterGenres
+
+			v := validator.New()
+			ValidateAnimeQuery(v, AnimeQuery{Genres: tt.genres})
+			if got := v.Errors["genres"]; got != tt.want {
+				t.Errorf("errors[genres] = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuggestEscapesPrefix(t *testing.T) {
+	tests := []struct {
+		q          string
+		wantPrefix string
+	}{
+		{"Naru", "naru%"},
+		{"100%", `100\%%`},
+		{"a_b", `a\_b%`},
+		{`c:\d`, `c:\\d%`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			pool, srv := newFakePool(t)
+			m := AnimeModel{DB: &DB{Pool: pool}}
+			suggestions, err := m.Suggest(context.Background(), tt.q, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(suggestions) != 0 {
+				t.Errorf("got %d suggestions; want none", len(suggestions))
+			}
+			queries := srv.Queries()
+			if len(queries) != 1 {
+				t.Fatalf("got %d queries; want 1", len(queries))
+			}
+			want := []string{tt.q, tt.wantPrefix, "5"}
+			if !reflect.DeepEqual(queries[0].Args, want) {
+				t.Errorf("args = %q; want %q", queries[0].Args, want)
+			}
+		})
+	}
+}
+
+func TestCapGenres(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       int
+		genres      int
+		wantGenres  int
+		wantWarning bool
+	}{
+		{"under the limit", 3, 2, 2, false},
+		{"at the limit", 3, 3, 3, false},
+		{"over the limit", 3, 1000, 3, true},
+		{"no limit", 0, 1000, 1000, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := AnimeLimits
+			defer func() { AnimeLimits = saved }()
+			AnimeLimits.MaxScannedGenres = tt.limit
+
+			var logs bytes.Buffer
+			db := &DB{Logger: jsonlog.New(&logs, jsonlog.LevelInfo)}
+			anime := &Anime{ID: 42, Genres: numberedGenres(tt.genres)}
+			capGenres(db, anime)
+
+			if len(anime.Genres) != tt.wantGenres {
+				t.Errorf("got %d genres; want %d", len(anime.Genres), tt.wantGenres)
+			}
+			warned := strings.Contains(logs.String(), `"level":"WARNING"`) && strings.Contains(logs.String(), `"anime_id":"42"`)
+			if warned != tt.wantWarning {
+				t.Errorf("warning logged = %t; want %t (logs: %s)", warned, tt.wantWarning, logs.String())
+			}
+		})
+	}
+}
+
+func TestGetAllCapsGenres(t *testing.T) {
+	saved := AnimeLimits
+	defer func() { AnimeLimits = saved }()
+	AnimeLimits.MaxScannedGenres = 2
+
+	pool, srv := newFakePool(t)
+	oids := []uint32{pgtype.Int8OID, pgtype.Int8OID, pgtype.TimestamptzOID, pgtype.TextOID, pgtype.Int4OID, pgtype.Int4OID,
+		pgtype.TextArrayOID, pgtype.TextOID, pgtype.Int4OID, pgtype.TextOID, pgtype.Int4OID, pgtype.TimestamptzOID}
+	srv.Respond("FROM animes", oids,
+		[]string{"1", "1", "2026-01-02 03:04:05+00", "Mushishi", "2005", "24", "{Mystery,Fantasy,Drama}", "TV", "26", "finished", "1", `\N`},
+	)
+	m := AnimeModel{DB: &DB{Pool: pool}}
+
+	animes, _, err := m.GetAll(context.Background(), AnimeQuery{}, Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(animes) != 1 {
+		t.Fatalf("got %d animes; want 1", len(animes))
+	}
+	if want := []string{"Mystery", "Fantasy"}; !reflect.DeepEqual(animes[0].Genres, want) {
+		t.Errorf("genres = %q; want %q", animes[0].Genres, want)
+	}
+	if animes[0].DeletedAt != nil {
+		t.Errorf("DeletedAt = %v; want nil", animes[0].DeletedAt)
+	}
+}
+
+func TestGetAllRelevance(t *testing.T) {
+	pool, srv := newFakePool(t)
+	m := AnimeModel{DB: &DB{Pool: pool}}
+	filters := Filters{Page: 1, PageSize: 20, Sort: "-relevance", SortSafelist: []string{"relevance", "-relevance"}}
+	if _, _, err := m.GetAll(context.Background(), AnimeQuery{Title: "cowboy bebop"}, filters); err != nil {
+		t.Fatal(err)
+	}
+
+	queries := srv.Queries()
+	want := "ORDER BY ts_rank(to_tsvector('simple', title), plainto_tsquery('simple', $1)) DESC, id ASC"
+	if len(queries) != 1 || !strings.Contains(queries[0].SQL, want) {
+		t.Fatalf("queries = %v; want one ordered with %q", queries, want)
+	}
+	if got := queries[0].Args[0]; got != "cowboy bebop" {
+		t.Errorf("$1 = %q; want the title query", got)
+	}
+}
+
+func TestPatchLegacyAnime(t *testing.T) {
+	pool, srv := newFakePool(t)
+	oids := []uint32{pgtype.Int8OID, pgtype.TimestamptzOID, pgtype.TextOID, pgtype.Int4OID, pgtype.Int4OID,
+		pgtype.TextArrayOID, pgtype.TextOID, pgtype.Int4OID, pgtype.TextOID, pgtype.Int4OID}
+	// A row from before the status was tracked, as migration 000022 leaves it.
+	srv.Respond("WHERE id = $1", oids,
+		[]string{"3", "2026-01-02 03:04:05+00", "Mushishi", "2005", "24", "{Mystery}", "TV", `\N`, "unknown", "1"},
+	)
+	m := AnimeModel{DB: &DB{Pool: pool}}
+
+	anime, err := m.Get(context.Background(), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changing just the title passes full validation, as a PATCH request does.
+	anime.Title = "Mushi-shi"
+	v := validator.New()
+	ValidateAnime(v, anime)
+	if !v.Valid() {
+		t.Errorf("errors = %v; want none for a legacy anime", v.Errors)
+	}
+}
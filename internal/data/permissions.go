@@ -2,7 +2,6 @@ package data
 
 import (
 	"context"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"time"
 )
 
@@ -21,21 +20,21 @@ func (p Permissions) Include(code string) bool {
 
 // Define the PermissionModel type.
 type PermissionModel struct {
-	DB *pgxpool.Pool
+	DB *DB
 }
 
 // The GetAllForUser() method returns all permission codes for a specific user in a
 // Permissions slice. The code in this method should feel very familiar --- it uses the
 // standard pattern that we've already seen before for retrieving multiple data rows in
 // an SQL query.
-func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
 	query := `
 SELECT permissions.code
 FROM permissions
 INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
 INNER JOIN users ON users_permissions.user_id = users.id
 WHERE users.id = $1`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 	rows, err := m.DB.Query(ctx, query, userID)
 	if err != nil {
@@ -57,12 +56,79 @@ WHERE users.id = $1`
 	return permissions, nil
 }
 
-func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
 	query := `
 INSERT INTO users_permissions
 SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 	_, err := m.DB.Exec(ctx, query, userID, codes)
 	return err
 }
+
+// AddRoleForUser() grants a user every permission in the named role. Permissions the
+// user already has are left alone. If there is no role with that name then
+// ErrRecordNotFound is returned. The returned Permissions slice contains the codes
+// which make up the role.
+func (m PermissionModel) AddRoleForUser(ctx context.Context, userID int64, role string) (Permissions, error) {
+	query := `
+SELECT permissions.id, permissions.code
+FROM roles
+LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+LEFT JOIN permissions ON roles_permissions.permission_id = permissions.id
+WHERE roles.name = $1`
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, query, role)
+	if err != nil {
+		return nil, err
+	}
+	found := false
+	var ids []int64
+	permissions := Permissions{}
+	for rows.Next() {
+		// A role without any permissions still returns a single row, with NULLs from
+		// the outer joins.
+		var id *int64
+		var code *string
+		err := rows.Scan(&id, &code)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		found = true
+		if id != nil {
+			ids = append(ids, *id)
+			permissions = append(permissions, *code)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, ErrRecordNotFound
+	}
+
+	query = `
+INSERT INTO users_permissions
+SELECT $1, unnest($2::bigint[])
+ON CONFLICT DO NOTHING`
+	_, err = tx.Exec(ctx, query, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
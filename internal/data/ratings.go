@@ -0,0 +1,161 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"greenlight.aida.kz/internal/validator"
+	"time"
+)
+
+// Define the range of permitted rating scores.
+const (
+	MinRatingScore = 1
+	MaxRatingScore = 10
+)
+
+// ErrRatingThrottled is returned by Upsert() when the user has already changed their
+// rating of the anime the maximum number of times within the current window.
+var ErrRatingThrottled = errors.New("rating changed too often")
+
+// RatingLimits controls how often a user can change their rating of the same anime.
+// A user may change it MaxChanges times, counted from the first change in a window,
+// before they have to wait for the Window to pass. A MaxChanges of zero or less
+// disables the limit.
+var RatingLimits = struct {
+	MaxChanges int
+	Window     time.Duration
+}{
+	MaxChanges: 5,
+	Window:     time.Hour,
+}
+
+type Rating struct {
+	UserID    int64     `json:"-"`
+	AnimeID   int64     `json:"anime_id"`
+	Score     int       `json:"score"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RatingSummary holds the aggregated ratings for an anime.
+type RatingSummary struct {
+	Average float64 `json:"average"`
+	Count   int64   `json:"count"`
+}
+
+func ValidateRating(v *validator.Validator, rating *Rating) {
+	v.Check(rating.Score >= MinRatingScore && rating.Score <= MaxRatingScore, "score", "must be between 1 and 10")
+}
+
+type RatingModel struct {
+	DB *DB
+}
+
+// Upsert() records a user's rating for an anime, replacing any rating they had
+// already given it. It returns ErrRecordNotFound if the anime doesn't exist, and
+// ErrRatingThrottled if the change would go over the RatingLimits.
+func (m RatingModel) Upsert(ctx context.Context, rating *Rating) error {
+	// The change counter restarts whenever a change is made after the window has
+	// expired. The WHERE clause stops the update once the limit is reached, in which
+	// case no row is returned.
+	query := `
+INSERT INTO ratings (user_id, anime_id, score)
+SELECT $1, id, $3 FROM animes WHERE id = $2 AND deleted_at IS NULL
+ON CONFLICT (user_id, anime_id) DO UPDATE SET
+	score = EXCLUDED.score,
+	updated_at = NOW(),
+	change_count = CASE WHEN ratings.window_started_at <= NOW() - make_interval(secs => $4::float8)
+		THEN 1 ELSE ratings.change_count + 1 END,
+	window_started_at = CASE WHEN ratings.window_started_at <= NOW() - make_interval(secs => $4::float8)
+		THEN NOW() ELSE ratings.window_started_at END
+WHERE $5::integer <= 0
+	OR ratings.change_count < $5::integer
+	OR ratings.window_started_at <= NOW() - make_interval(secs => $4::float8)
+RETURNING created_at, updated_at`
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	args := []any{rating.UserID, rating.AnimeID, rating.Score, RatingLimits.Window.Seconds(), RatingLimits.MaxChanges}
+	err := m.DB.QueryRow(ctx, query, args...).Scan(&rating.CreatedAt, &rating.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return m.upsertMissReason(ctx, rating)
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// upsertMissReason() works out why Upsert() didn't return a row: either the anime
+// doesn't exist, or it does and the user's existing rating of it has been throttled.
+func (m RatingModel) upsertMissReason(ctx context.Context, rating *Rating) error {
+	query := `
+SELECT EXISTS (
+	SELECT 1 FROM ratings
+	INNER JOIN animes ON animes.id = ratings.anime_id
+	WHERE ratings.user_id = $1 AND ratings.anime_id = $2 AND animes.deleted_at IS NULL
+)`
+	var throttled bool
+	err := m.DB.QueryRow(ctx, query, rating.UserID, rating.AnimeID).Scan(&throttled)
+	if err != nil {
+		return err
+	}
+	if throttled {
+		return ErrRatingThrottled
+	}
+	return ErrRecordNotFound
+}
+
+// AveragesForAnimes() returns the rating summary for each of the given animes in a
+// single query. Animes without any ratings get a zeroed summary.
+func (m RatingModel) AveragesForAnimes(ctx context.Context, ids []int64) (map[int64]RatingSummary, error) {
+	query := `
+SELECT anime_id, avg(score)::float8, count(*)
+FROM ratings
+WHERE anime_id = ANY($1)
+GROUP BY anime_id`
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := make(map[int64]RatingSummary, len(ids))
+	for _, id := range ids {
+		summaries[id] = RatingSummary{}
+	}
+	for rows.Next() {
+		var id int64
+		var summary RatingSummary
+		err := rows.Scan(&id, &summary.Average, &summary.Count)
+		if err != nil {
+			return nil, err
+		}
+		summaries[id] = summary
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// DeleteAllForUser() deletes all of a user's ratings, returning the number of ratings
+// which were removed. The rating summaries are calculated on demand, so they reflect
+// the deletion straight away.
+func (m RatingModel) DeleteAllForUser(ctx context.Context, userID int64) (int64, error) {
+	query := `
+DELETE FROM ratings
+WHERE user_id = $1`
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	result, err := m.DB.Exec(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
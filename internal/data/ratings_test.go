@@ -0,0 +1,131 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgtype"
+	"greenlight.aida.kz/internal/validator"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateRating(t *testing.T) {
+	tests := []struct {
+		score int
+		valid bool
+	}{
+		{0, false},
+		{1, true},
+		{10, true},
+		{11, false},
+		{-3, false},
+	}
+	for _, tt := range tests {
+		v := validator.New()
+		ValidateRating(v, &Rating{Score: tt.score})
+		if v.Valid() != tt.valid {
+			t.Errorf("score %d: valid = %t; want %t", tt.score, v.Valid(), tt.valid)
+		}
+	}
+}
+
+func TestAveragesForAnimes(t *testing.T) {
+	pool, srv := newFakePool(t)
+	srv.Respond("GROUP BY anime_id", []uint32{pgtype.Int8OID, pgtype.Float8OID, pgtype.Int8OID},
+		[]string{"1", "7.5", "2"},
+		[]string{"3", "9", "1"},
+	)
+	m := RatingModel{DB: &DB{Pool: pool}}
+
+	got, err := m.AveragesForAnimes(context.Background(), []int64{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int64]RatingSummary{
+		1: {Average: 7.5, Count: 2},
+		2: {},
+		3: {Average: 9, Count: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	if queries := srv.Queries(); len(queries) != 1 || !reflect.DeepEqual(queries[0].Args, []string{"{1,2,3}"}) {
+		t.Errorf("queries = %v; want a single query for {1,2,3}", queries)
+	}
+}
+
+func TestDeleteAllForUser(t *testing.T) {
+	pool, srv := newFakePool(t)
+	srv.RespondTag("DELETE FROM ratings", "DELETE 4")
+	m := RatingModel{DB: &DB{Pool: pool}}
+
+	count, err := m.DeleteAllForUser(context.Background(), 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 {
+		t.Errorf("count = %d; want 4", count)
+	}
+	// Only the caller's ratings are deleted.
+	queries := srv.Queries()
+	if len(queries) != 1 || !strings.Contains(queries[0].SQL, "WHERE user_id = $1") || !reflect.DeepEqual(queries[0].Args, []string{"7"}) {
+		t.Errorf("queries = %v; want a single delete of user 7's ratings", queries)
+	}
+}
+
+func TestUpsertThrottling(t *testing.T) {
+	saved := RatingLimits
+	defer func() { RatingLimits = saved }()
+	RatingLimits.MaxChanges = 3
+	RatingLimits.Window = 90 * time.Minute
+
+	timestamps := []uint32{pgtype.TimestamptzOID, pgtype.TimestamptzOID}
+	tests := []struct {
+		name    string
+		seed    func(srv *fakeServer)
+		wantErr error
+	}{
+		{
+			name: "accepted",
+			seed: func(srv *fakeServer) {
+				srv.Respond("INSERT INTO ratings", timestamps, []string{"2026-01-02 03:04:05+00", "2026-01-03 03:04:05+00"})
+			},
+		},
+		{
+			name: "throttled",
+			seed: func(srv *fakeServer) {
+				srv.Respond("INSERT INTO ratings", timestamps)
+				srv.Respond("SELECT EXISTS", []uint32{pgtype.BoolOID}, []string{"t"})
+			},
+			wantErr: ErrRatingThrottled,
+		},
+		{
+			name: "missing anime",
+			seed: func(srv *fakeServer) {
+				srv.Respond("INSERT INTO ratings", timestamps)
+				srv.Respond("SELECT EXISTS", []uint32{pgtype.BoolOID}, []string{"f"})
+			},
+			wantErr: ErrRecordNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, srv := newFakePool(t)
+			tt.seed(srv)
+			m := RatingModel{DB: &DB{Pool: pool}}
+
+			err := m.Upsert(context.Background(), &Rating{UserID: 7, AnimeID: 2, Score: 8})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v; want %v", err, tt.wantErr)
+			}
+			// The limits are passed to the upsert as the window in seconds and the
+			// maximum number of changes.
+			args := srv.Queries()[0].Args
+			if want := []string{"7", "2", "8", "5400", "3"}; !reflect.DeepEqual(args, want) {
+				t.Errorf("upsert args = %q; want %q", args, want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package data
 import (
 	"errors"
 	"fmt"
+	"greenlight.aida.kz/internal/validator"
 	"strconv"
 	"strings"
 )
@@ -11,7 +12,17 @@ var ErrInvalidRuntimeFormat = errors.New("invalid runtime format")
 
 type Runtime int32
 
+// StrictRuntime controls how a zero runtime is rendered. Normally a zero runtime is
+// omitted from responses by the omitempty directive on the Anime struct, which means
+// that clients can't tell whether it's missing or zero. When StrictRuntime is true a
+// zero runtime is marshaled as an explicit null instead (see
+// Anime.WithStrictRuntime()).
+var StrictRuntime bool
+
 func (r Runtime) MarshalJSON() ([]byte, error) {
+	if r == 0 && StrictRuntime {
+		return []byte("null"), nil
+	}
 	jsonValue := fmt.Sprintf("%d mins", r)
 	quotedJSONValue := strconv.Quote(jsonValue)
 	return []byte(quotedJSONValue), nil
@@ -33,3 +44,25 @@ func (r *Runtime) UnmarshalJSON(jsonValue []byte) error {
 	*r = Runtime(i)
 	return nil
 }
+
+// ParseRuntimeLimits parses a comma-separated list of MediaType=minutes pairs, such as
+// "Movie=300,OVA=120", into a map of the maximum runtime for each media type.
+func ParseRuntimeLimits(s string) (map[string]Runtime, error) {
+	limits := make(map[string]Runtime)
+	if strings.TrimSpace(s) == "" {
+		return limits, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		mediaType, value, ok := strings.Cut(pair, "=")
+		mediaType = strings.TrimSpace(mediaType)
+		mins, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+		if !ok || err != nil || mins < 1 {
+			return nil, errors.New("runtime limits must be in the format MediaType=minutes, with a positive number of minutes")
+		}
+		if !validator.PermittedValue(mediaType, MediaTypes...) {
+			return nil, fmt.Errorf("unknown media type %q", mediaType)
+		}
+		limits[mediaType] = Runtime(mins)
+	}
+	return limits, nil
+}
@@ -0,0 +1,59 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseRuntimeLimits(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    map[string]Runtime
+		wantErr bool
+	}{
+		{"", map[string]Runtime{}, false},
+		{"Movie=300", map[string]Runtime{MediaMovie: 300}, false},
+		{" Movie = 300 , OVA=120", map[string]Runtime{MediaMovie: 300, MediaOVA: 120}, false},
+		{"Movie", nil, true},
+		{"Movie=0", nil, true},
+		{"Movie=-10", nil, true},
+		{"Movie=long", nil, true},
+		{"movie=300", nil, true},
+		{"Film=300", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRuntimeLimits(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRuntimeLimits(%q): err = %v; want error: %t", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRuntimeLimits(%q) = %v; want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRuntimeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    Runtime
+		wantErr error
+	}{
+		{`"107 mins"`, 107, nil},
+		{`"0 mins"`, 0, nil},
+		{`107`, 0, ErrInvalidRuntimeFormat},
+		{`"107"`, 0, ErrInvalidRuntimeFormat},
+		{`"107 minutes"`, 0, ErrInvalidRuntimeFormat},
+		{`"abc mins"`, 0, ErrInvalidRuntimeFormat},
+		{`"99999999999 mins"`, 0, ErrInvalidRuntimeFormat},
+	}
+	for _, tt := range tests {
+		var got Runtime
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if !errors.Is(err, tt.wantErr) || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, %v; want %d, %v", tt.json, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Define the modes for sanitizing HTML in anime titles and genres. In SanitizeOff
+// mode text is stored as given, in SanitizeStrip mode any HTML tags (along with the
+// contents of script and style elements) are removed, and in SanitizeEscape mode the
+// HTML special characters are escaped.
+const (
+	SanitizeOff    = "off"
+	SanitizeStrip  = "strip"
+	SanitizeEscape = "escape"
+)
+
+var (
+	scriptRX = regexp.MustCompile(`(?is)<(script|style)\b[^>]*>.*?(</(script|style)\s*>|$)`)
+	tagRX    = regexp.MustCompile(`(?s)</?[a-zA-Z!][^>]*>?`)
+)
+
+// SanitizeText sanitizes a title or other free text according to mode.
+func SanitizeText(s, mode string) string {
+	switch mode {
+	case SanitizeStrip:
+		s = scriptRX.ReplaceAllString(s, "")
+		return strings.TrimSpace(tagRX.ReplaceAllString(s, ""))
+	case SanitizeEscape:
+		return html.EscapeString(s)
+	default:
+		return s
+	}
+}
+
+// SanitizeGenres returns a copy of genres with each genre sanitized according to mode.
+// A nil slice is returned as nil.
+func SanitizeGenres(genres []string, mode string) []string {
+	if genres == nil || mode == SanitizeOff {
+		return genres
+	}
+	sanitized := make([]string, len(genres))
+	for i, genre := range genres {
+		sanitized[i] = SanitizeText(genre, mode)
+	}
+	return sanitized
+}
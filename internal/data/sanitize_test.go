@@ -0,0 +1,56 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSanitizeText(t *testing.T) {
+	tests := []struct {
+		mode  string
+		input string
+		want  string
+	}{
+		{SanitizeOff, "<script>alert(1)</script>Akira", "<script>alert(1)</script>Akira"},
+		{SanitizeStrip, "<script>alert(1)</script>Akira", "Akira"},
+		{SanitizeStrip, "Akira<SCRIPT type=\"text/javascript\">alert(1)</SCRIPT >", "Akira"},
+		{SanitizeStrip, "Akira<script>alert(1)", "Akira"},
+		{SanitizeStrip, "<style>body{}</style><b>Akira</b>", "Akira"},
+		{SanitizeStrip, "<img src=x onerror=alert(1)>Akira", "Akira"},
+		{SanitizeStrip, "Akira<img src=x onerror=alert(1)", "Akira"},
+		{SanitizeStrip, "Fate/stay night", "Fate/stay night"},
+		{SanitizeStrip, "Steins;Gate & K-On! 3 < 5 > 4", "Steins;Gate & K-On! 3 < 5 > 4"},
+		{SanitizeStrip, "Кибер «Аниме» 攻殻機動隊", "Кибер «Аниме» 攻殻機動隊"},
+		{SanitizeEscape, "<script>alert(\"1\")</script>", "&lt;script&gt;alert(&#34;1&#34;)&lt;/script&gt;"},
+		{SanitizeEscape, "Fate/stay night", "Fate/stay night"},
+		{SanitizeEscape, "Tom & Jerry's", "Tom &amp; Jerry&#39;s"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeText(tt.input, tt.mode); got != tt.want {
+			t.Errorf("SanitizeText(%q, %q) = %q; want %q", tt.input, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeGenres(t *testing.T) {
+	tests := []struct {
+		mode   string
+		genres []string
+		want   []string
+	}{
+		{SanitizeStrip, nil, nil},
+		{SanitizeStrip, []string{"<b>Action</b>", "Sci-Fi"}, []string{"Action", "Sci-Fi"}},
+		{SanitizeEscape, []string{"<b>Action</b>"}, []string{"&lt;b&gt;Action&lt;/b&gt;"}},
+		{SanitizeOff, []string{"<b>Action</b>"}, []string{"<b>Action</b>"}},
+	}
+	for _, tt := range tests {
+		input := append([]string(nil), tt.genres...)
+		got := SanitizeGenres(tt.genres, tt.mode)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SanitizeGenres(%q, %q) = %q; want %q", tt.genres, tt.mode, got, tt.want)
+		}
+		if !reflect.DeepEqual(tt.genres, input) && tt.genres != nil {
+			t.Errorf("SanitizeGenres(%q, %q) modified its input", input, tt.mode)
+		}
+	}
+}
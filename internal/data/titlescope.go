@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Define the scopes within which anime titles must be unique. Titles are always
+// compared case-insensitively, and soft-deleted animes are never counted.
+const (
+	TitleScopeTitle              = "title"
+	TitleScopeTitleYear          = "title+year"
+	TitleScopeTitleYearMediaType = "title+year+media_type"
+)
+
+// TitleScopes lists the supported title uniqueness scopes.
+var TitleScopes = []string{TitleScopeTitle, TitleScopeTitleYear, TitleScopeTitleYearMediaType}
+
+// TitleScope is the scope within which anime titles must be unique. The unique index
+// enforcing it is created by a migration, and checked by CheckTitleScope().
+var TitleScope = TitleScopeTitleYear
+
+// titleScope describes how duplicates are detected for one of the TitleScopes.
+type titleScope struct {
+	index     string
+	year      bool
+	mediaType bool
+	message   string
+}
+
+var titleScopes = map[string]titleScope{
+	TitleScopeTitle: {
+		index:   "animes_title_key",
+		message: "an anime with this title already exists",
+	},
+	TitleScopeTitleYear: {
+		index:   "animes_title_year_key",
+		year:    true,
+		message: "an anime with this title and year already exists",
+	},
+	TitleScopeTitleYearMediaType: {
+		index:     "animes_title_year_media_type_key",
+		year:      true,
+		mediaType: true,
+		message:   "an anime with this title, year and media type already exists",
+	},
+}
+
+func currentTitleScope() titleScope {
+	return titleScopes[TitleScope]
+}
+
+// DuplicateTitleMessage returns the message describing a duplicate anime under the
+// current TitleScope.
+func DuplicateTitleMessage() string {
+	return currentTitleScope().message
+}
+
+// columns returns the column list of the unique index for the scope.
+func (s titleScope) columns() string {
+	columns := "lower(title)"
+	if s.year {
+		columns += ", year"
+	}
+	if s.mediaType {
+		columns += ", media_type"
+	}
+	return columns
+}
+
+// key returns the key used to detect duplicate animes within a batch.
+func (s titleScope) key(title string, year int32, mediaType string) string {
+	key := strings.ToLower(title)
+	if s.year {
+		key += fmt.Sprintf("|%d", year)
+	}
+	if s.mediaType {
+		key += "|" + mediaType
+	}
+	return key
+}
+
+// match returns a condition matching the animes which would be duplicates of anime
+// under the scope, along with the arguments for its placeholders.
+func (s titleScope) match(anime *Anime) (string, []any) {
+	conditions := []string{"lower(title) = lower($1)"}
+	args := []any{anime.Title}
+	if s.year {
+		args = append(args, anime.Year)
+		conditions = append(conditions, fmt.Sprintf("year = $%d", len(args)))
+	}
+	if s.mediaType {
+		args = append(args, anime.MediaType)
+		conditions = append(conditions, fmt.Sprintf("media_type = $%d", len(args)))
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// CheckTitleScope() checks that the unique index for the current TitleScope exists,
+// and that the indexes for the other scopes don't, since they would reject animes the
+// current scope allows. It should be called once at startup.
+//
+// The indexes are created by migrations rather than by the application. The numbered
+// migrations create the index for the default title+year scope. Each other scope has
+// its own directory under migrations/title_scopes, which replaces that index with its
+// own. Apply it with its own migrations table, for example:
+//
+//	migrate -path ./migrations/title_scopes/title -database "<db-dsn>&x-migrations-table=title_scope_migrations" up
+//
+// Migrating it back down restores the default index.
+func (m AnimeModel) CheckTitleScope(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	indexes := make([]string, 0, len(TitleScopes))
+	for _, name := range TitleScopes {
+		indexes = append(indexes, titleScopes[name].index)
+	}
+	query := `
+SELECT indexname
+FROM pg_indexes
+WHERE schemaname = current_schema() AND tablename = 'animes' AND indexname = ANY($1)`
+
+	rows, err := m.DB.Query(ctx, query, indexes)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	found := make(map[string]bool)
+	for rows.Next() {
+		var index string
+		err := rows.Scan(&index)
+		if err != nil {
+			return err
+		}
+		found[index] = true
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	current := currentTitleScope()
+	if !found[current.index] {
+		return fmt.Errorf("the %s title scope needs the %s index, which is created by its migration", TitleScope, current.index)
+	}
+	for _, index := range indexes {
+		if index != current.index && found[index] {
+			return fmt.Errorf("the %s index must be dropped to use the %s title scope", index, TitleScope)
+		}
+	}
+	return nil
+}
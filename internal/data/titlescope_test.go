@@ -0,0 +1,152 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgtype"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTitleScopeKey(t *testing.T) {
+	tests := []struct {
+		scope string
+		a, b  *Anime
+		equal bool
+	}{
+		{TitleScopeTitle, &Anime{Title: "Akira", Year: 1988}, &Anime{Title: "AKIRA", Year: 2020}, true},
+		{TitleScopeTitleYear, &Anime{Title: "Akira", Year: 1988}, &Anime{Title: "akira", Year: 1988}, true},
+		{TitleScopeTitleYear, &Anime{Title: "Akira", Year: 1988}, &Anime{Title: "Akira", Year: 2020}, false},
+		{TitleScopeTitleYear, &Anime{Title: "Akira", Year: 1988, MediaType: MediaMovie}, &Anime{Title: "Akira", Year: 1988, MediaType: MediaTV}, true},
+		{TitleScopeTitleYearMediaType, &Anime{Title: "Akira", Year: 1988, MediaType: MediaMovie}, &Anime{Title: "Akira", Year: 1988, MediaType: MediaTV}, false},
+		{TitleScopeTitleYearMediaType, &Anime{Title: "Akira", Year: 1988, MediaType: MediaMovie}, &Anime{Title: "AKIRA", Year: 1988, MediaType: MediaMovie}, true},
+	}
+	for _, tt := range tests {
+		scope := titleScopes[tt.scope]
+		a := scope.key(tt.a.Title, tt.a.Year, tt.a.MediaType)
+		b := scope.key(tt.b.Title, tt.b.Year, tt.b.MediaType)
+		if (a == b) != tt.equal {
+			t.Errorf("%s: key(%+v) = %q, key(%+v) = %q; want equal: %t", tt.scope, tt.a, a, tt.b, b, tt.equal)
+		}
+	}
+}
+
+func TestTitleScopeMatch(t *testing.T) {
+	anime := &Anime{Title: "Akira", Year: 1988, MediaType: MediaMovie}
+	tests := []struct {
+		scope    string
+		want     string
+		wantArgs []any
+		columns  string
+	}{
+		{TitleScopeTitle, "lower(title) = lower($1)", []any{"Akira"}, "lower(title)"},
+		{TitleScopeTitleYear, "lower(title) = lower($1) AND year = $2", []any{"Akira", int32(1988)}, "lower(title), year"},
+		{TitleScopeTitleYearMediaType, "lower(title) = lower($1) AND year = $2 AND media_type = $3", []any{"Akira", int32(1988), MediaMovie}, "lower(title), year, media_type"},
+	}
+	for _, tt := range tests {
+		scope := titleScopes[tt.scope]
+		got, args := scope.match(anime)
+		if got != tt.want || !reflect.DeepEqual(args, tt.wantArgs) {
+			t.Errorf("%s: match() = %q, %v; want %q, %v", tt.scope, got, args, tt.want, tt.wantArgs)
+		}
+		if got := scope.columns(); got != tt.columns {
+			t.Errorf("%s: columns() = %q; want %q", tt.scope, got, tt.columns)
+		}
+	}
+}
+
+func TestDuplicateTitleMessage(t *testing.T) {
+	saved := TitleScope
+	defer func() { TitleScope = saved }()
+
+	tests := map[string]string{
+		TitleScopeTitle:              "an anime with this title already exists",
+		TitleScopeTitleYear:          "an anime with this title and year already exists",
+		TitleScopeTitleYearMediaType: "an anime with this title, year and media type already exists",
+	}
+	for scope, want := range tests {
+		TitleScope = scope
+		if got := DuplicateTitleMessage(); got != want {
+			t.Errorf("%s: DuplicateTitleMessage() = %q; want %q", scope, got, want)
+		}
+	}
+}
+
+func TestCheckTitleScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   string
+		indexes []string
+		wantErr string
+	}{
+		{"default scope", TitleScopeTitleYear, []string{"animes_title_year_key"}, ""},
+		{"migrated scope", TitleScopeTitle, []string{"animes_title_key"}, ""},
+		{"missing index", TitleScopeTitleYearMediaType, []string{"animes_title_year_key"}, "needs the animes_title_year_media_type_key index"},
+		{"no indexes", TitleScopeTitleYear, nil, "needs the animes_title_year_key index"},
+		{"other scope's index left behind", TitleScopeTitle, []string{"animes_title_key", "animes_title_year_key"}, "the animes_title_year_key index must be dropped"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := TitleScope
+			defer func() { TitleScope = saved }()
+			TitleScope = tt.scope
+
+			pool, srv := newFakePool(t)
+			var rows [][]string
+			for _, index := range tt.indexes {
+				rows = append(rows, []string{index})
+			}
+			srv.Respond("FROM pg_indexes", []uint32{pgtype.TextOID}, rows...)
+			m := AnimeModel{DB: &DB{Pool: pool}}
+
+			err := m.CheckTitleScope(context.Background())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v; want it to contain %q", err, tt.wantErr)
+			}
+			// The check only reads the catalog, and never changes the indexes.
+			for _, q := range srv.Queries() {
+				if sql := strings.ToLower(q.SQL); strings.Contains(sql, "create") || strings.Contains(sql, "drop") {
+					t.Errorf("ran %q", q.SQL)
+				}
+			}
+		})
+	}
+}
+
+func TestInsertManyTitleScope(t *testing.T) {
+	saved := TitleScope
+	defer func() { TitleScope = saved }()
+	TitleScope = TitleScopeTitle
+
+	pool, srv := newFakePool(t)
+	srv.Respond("SELECT DISTINCT", []uint32{pgtype.TextOID, pgtype.Int4OID, pgtype.TextOID}, []string{"akira", "1988", "Movie"})
+	m := AnimeModel{DB: &DB{Pool: pool}}
+
+	animes := []*Anime{
+		{Title: "Akira", Year: 2020, MediaType: MediaTV},
+		{Title: "Mushishi", Year: 2005, MediaType: MediaTV},
+		{Title: "MUSHISHI", Year: 2014, MediaType: MediaSpecial},
+	}
+	report, err := m.InsertMany(context.Background(), animes, DuplicatesFail)
+	if !errors.Is(err, ErrDuplicateAnime) {
+		t.Fatalf("err = %v; want %v", err, ErrDuplicateAnime)
+	}
+	// Only the title counts, so neither the year nor the media type tells them apart.
+	want := []BatchConflict{
+		{Index: 0, Title: "Akira", Year: 2020, Reason: "an anime with this title already exists"},
+		{Index: 2, Title: "MUSHISHI", Year: 2014, Reason: ReasonDuplicateInBatch},
+	}
+	if !reflect.DeepEqual(report.Conflicts, want) {
+		t.Errorf("conflicts = %+v; want %+v", report.Conflicts, want)
+	}
+	for _, q := range srv.Queries() {
+		if strings.Contains(q.SQL, "SELECT DISTINCT") && strings.Contains(q.SQL, "animes.year = batch.year") {
+			t.Errorf("lookup %q matches on the year", q.SQL)
+		}
+	}
+}
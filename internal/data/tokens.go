@@ -5,7 +5,8 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base32"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"errors"
+	"github.com/jackc/pgx/v5"
 	"greenlight.aida.kz/internal/validator"
 	"time"
 )
@@ -15,6 +16,7 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeAnimeCommit    = "anime-commit"
 )
 
 // Define a Token struct to hold the data for an individual token. This includes the
@@ -26,6 +28,8 @@ type Token struct {
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	// Payload holds the JSON data that the token was issued for, if any.
+	Payload []byte `json:"-"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -72,38 +76,89 @@ func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 
 // Define the TokenModel type.
 type TokenModel struct {
-	DB *pgxpool.Pool
+	DB *DB
 }
 
 // The New() method is a shortcut which creates a new Token struct and then inserts the
 // data in the tokens table.
-func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token, error) {
+func (m TokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
 	token, err := generateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
-	err = m.Insert(token)
+	err = m.Insert(ctx, token)
 	return token, err
 }
 
-func (m TokenModel) Insert(token *Token) error {
+// NewWithPayload() creates and inserts a new token which carries a JSON payload, to be
+// retrieved later with Consume().
+func (m TokenModel) NewWithPayload(ctx context.Context, userID int64, ttl time.Duration, scope string, payload []byte) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+	token.Payload = payload
+	err = m.Insert(ctx, token)
+	return token, err
+}
+
+func (m TokenModel) Insert(ctx context.Context, token *Token) error {
 	query := `
-INSERT INTO tokens (hash, user_id, expiry, scope)
-VALUES ($1, $2, $3, $4)`
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+INSERT INTO tokens (hash, user_id, expiry, scope, payload)
+VALUES ($1, $2, $3, $4, $5)`
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.Payload}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 	_, err := m.DB.Exec(ctx, query, args...)
 	return err
 }
 
+// Consume() deletes an unexpired token with the given scope which belongs to the user,
+// and returns its payload. Each token can only be consumed once. If there's no
+// matching token ErrRecordNotFound is returned.
+func (m TokenModel) Consume(ctx context.Context, scope, tokenPlaintext string, userID int64) ([]byte, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+DELETE FROM tokens
+WHERE hash = $1 AND scope = $2 AND user_id = $3 AND expiry > $4
+RETURNING payload`
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	var payload []byte
+	err := m.DB.QueryRow(ctx, query, tokenHash[:], scope, userID, time.Now()).Scan(&payload)
+	if err != nil {
+		switch {
+		case errors.Is(err, pgx.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
 // DeleteAllForUser() deletes all tokens for a specific user and scope.
-func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
+func (m TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
 	query := `
 DELETE FROM tokens
 WHERE scope = $1 AND user_id = $2`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 	_, err := m.DB.Exec(ctx, query, scope, userID)
 	return err
 }
+
+// DeleteExpired() deletes all tokens, across every scope, whose expiry time has
+// passed. It returns the number of tokens which were removed.
+func (m TokenModel) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `
+DELETE FROM tokens
+WHERE expiry < $1`
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	result, err := m.DB.Exec(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgtype"
+	"testing"
+	"time"
+)
+
+func TestConsume(t *testing.T) {
+	const plaintext = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	tests := []struct {
+		name    string
+		rows    [][]string
+		want    string
+		wantErr error
+	}{
+		// Expired, used and other users' tokens aren't matched by the query.
+		{"no matching token", nil, "", ErrRecordNotFound},
+		{"valid token", [][]string{{`\x7b227469746c65223a22416b697261227d`}}, `{"title":"Akira"}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, srv := newFakePool(t)
+			srv.Respond("DELETE FROM tokens", []uint32{pgtype.ByteaOID}, tt.rows...)
+			m := TokenModel{DB: &DB{Pool: pool}}
+
+			before := time.Now()
+			payload, err := m.Consume(context.Background(), ScopeAnimeCommit, plaintext, 7)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v; want %v", err, tt.wantErr)
+			}
+			if string(payload) != tt.want {
+				t.Errorf("payload = %s; want %s", payload, tt.want)
+			}
+
+			queries := srv.Queries()
+			if len(queries) != 1 || len(queries[0].Args) != 4 {
+				t.Fatalf("queries = %v; want one with 4 arguments", queries)
+			}
+			args := queries[0].Args
+			hash := sha256.Sum256([]byte(plaintext))
+			if want := fmt.Sprintf(`\x%x`, hash[:]); args[0] != want {
+				t.Errorf("hash = %s; want %s", args[0], want)
+			}
+			if args[1] != ScopeAnimeCommit || args[2] != "7" {
+				t.Errorf("scope and user = %s, %s; want %s, 7", args[1], args[2], ScopeAnimeCommit)
+			}
+			// Tokens which have expired by now must not match.
+			expiry, err := time.Parse("2006-01-02 15:04:05.999999999Z07:00", args[3])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expiry.Before(before.Truncate(time.Microsecond)) || expiry.After(time.Now()) {
+				t.Errorf("expiry cutoff = %v; want the current time", expiry)
+			}
+		})
+	}
+}
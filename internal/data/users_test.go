@@ -0,0 +1,136 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5/pgtype"
+	"greenlight.aida.kz/internal/validator"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidatePasswordPlaintext(t *testing.T) {
+	type rules struct {
+		minLength                              int
+		requireDigit, requireSymbol, mixedCase bool
+	}
+	tests := []struct {
+		name     string
+		rules    rules
+		password string
+		want     map[string]string
+	}{
+		{"default rules", rules{minLength: 8}, "pa55word", map[string]string{}},
+		{"empty", rules{minLength: 8}, "", map[string]string{"password": "must be provided"}},
+		{"too short", rules{minLength: 8}, "short", map[string]string{"password": "must be at least 8 bytes long"}},
+		{"configured minimum", rules{minLength: 12}, "pa55word", map[string]string{"password": "must be at least 12 bytes long"}},
+		{"too long", rules{minLength: 8}, strings.Repeat("a", 73), map[string]string{"password": "must not be more than 72 bytes long"}},
+		{"length is in bytes", rules{minLength: 8}, "пароль", map[string]string{}},
+		{"missing digit", rules{minLength: 8, requireDigit: true}, "password", map[string]string{"password_digit": "password must contain at least one digit"}},
+		{"missing symbol", rules{minLength: 8, requireSymbol: true}, "pa55word", map[string]string{"password_symbol": "password must contain at least one symbol"}},
+		{"missing upper case", rules{minLength: 8, mixedCase: true}, "pa55word", map[string]string{"password_case": "password must contain both upper and lower case letters"}},
+		{"missing lower case", rules{minLength: 8, mixedCase: true}, "PA55WORD", map[string]string{"password_case": "password must contain both upper and lower case letters"}},
+		{
+			name:     "every rule broken",
+			rules:    rules{minLength: 10, requireDigit: true, requireSymbol: true, mixedCase: true},
+			password: "password",
+			want: map[string]string{
+				"password":        "must be at least 10 bytes long",
+				"password_digit":  "password must contain at least one digit",
+				"password_symbol": "password must contain at least one symbol",
+				"password_case":   "password must contain both upper and lower case letters",
+			},
+		},
+		{"every rule met", rules{minLength: 10, requireDigit: true, requireSymbol: true, mixedCase: true}, "Pa55word!x", map[string]string{}},
+	}
+	saved := PasswordRules
+	defer func() { PasswordRules = saved }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			PasswordRules.MinLength = tt.rules.minLength
+			PasswordRules.RequireDigit = tt.rules.requireDigit
+			PasswordRules.RequireSymbol = tt.rules.requireSymbol
+			PasswordRules.RequireMixedCase = tt.rules.mixedCase
+
+			v := validator.New()
+			ValidatePasswordPlaintext(v, tt.password)
+			if !reflect.DeepEqual(v.Errors, tt.want) {
+				t.Errorf("errors = %v; want %v", v.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	pool, srv := newFakePool(t)
+	oids := []uint32{pgtype.Int8OID, pgtype.TimestamptzOID, pgtype.TextOID, pgtype.TextOID, pgtype.ByteaOID, pgtype.BoolOID, pgtype.BoolOID, pgtype.Int4OID}
+	// Only two of the three requested users exist.
+	srv.Respond("FROM users", oids,
+		[]string{"1", "2026-01-02 03:04:05+00", "Alice", "alice@example.com", `\x00`, "t", "f", "1"},
+		[]string{"5", "2026-02-03 04:05:06+00", "Bob", "bob@example.com", `\x00`, "t", "t", "3"},
+	)
+	m := UserModel{DB: &DB{Pool: pool}}
+
+	users, err := m.GetMany(context.Background(), []int64{1, 2, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("got %d users; want 2", len(users))
+	}
+	if users[0].ID != 1 || users[0].Name != "Alice" || users[0].Suspended {
+		t.Errorf("users[0] = %+v; want Alice", users[0])
+	}
+	if users[1].ID != 5 || users[1].Email != "bob@example.com" || !users[1].Suspended || users[1].Version != 3 {
+		t.Errorf("users[1] = %+v; want Bob", users[1])
+	}
+	if want := time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC); !users[1].CreatedAt.Equal(want) {
+		t.Errorf("users[1].CreatedAt = %v; want %v", users[1].CreatedAt, want)
+	}
+	if queries := srv.Queries(); len(queries) != 1 || !reflect.DeepEqual(queries[0].Args, []string{"{1,2,5}"}) {
+		t.Errorf("queries = %v; want a single query for {1,2,5}", queries)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		deleted string
+		wantErr error
+		wantEnd string
+	}{
+		{"existing user", "DELETE 1", nil, "commit"},
+		{"unknown user", "DELETE 0", ErrRecordNotFound, "rollback"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool, srv := newFakePool(t)
+			srv.RespondTag("UPDATE animes", "UPDATE 3")
+			srv.RespondTag("DELETE FROM users", tt.deleted)
+			m := UserModel{DB: &DB{Pool: pool}}
+
+			err := m.Delete(context.Background(), 7)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v; want %v", err, tt.wantErr)
+			}
+
+			// The user's animes are anonymized, rather than deleted, in the same
+			// transaction as the user is deleted.
+			var got []string
+			for _, q := range srv.Queries() {
+				got = append(got, strings.ToLower(strings.TrimSpace(q.SQL)))
+			}
+			want := []string{
+				"begin",
+				"update animes set created_by = null where created_by = $1",
+				"delete from users where id = $1",
+				tt.wantEnd,
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("queries = %q; want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package i18n
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is used when the client doesn't ask for a supported language.
+const DefaultLanguage = "en"
+
+// The catalog maps a language to the translations of each message. Messages are keyed
+// by their English text, which is what the validator and error helpers produce, so a
+// message without a translation simply falls back to English. Messages built around a
+// configurable number are keyed by a template with %d in place of the number.
+var catalog = map[string]map[string]string{
+	"ru": {
+		// Validation messages.
+		"must be provided":                              "обязательное поле",
+		"must be a valid email address":                 "должен быть действительным адресом электронной почты",
+		"must be at least %d bytes long":                "должен содержать не менее %d байт",
+		"must not be more than 72 bytes long":           "должен содержать не более 72 байт",
+		"must not be more than 500 bytes long":          "должно содержать не более 500 байт",
+		"must be 26 bytes long":                         "должен содержать 26 байт",
+		"must be greater than 1888":                     "должен быть больше 1888",
+		"must not be in the future":                     "не может быть в будущем",
+		"must be a positive integer":                    "должно быть положительным целым числом",
+		"must be an integer value":                      "должно быть целым числом",
+		"must be a boolean value":                       "должно быть логическим значением",
+		"must contain at least 1 genre":                 "должен содержать хотя бы 1 жанр",
+		"must not contain more than 5 genres":           "должен содержать не более 5 жанров",
+		"must not contain duplicate values":             "не должен содержать повторяющихся значений",
+		"invalid sort value":                            "недопустимое значение сортировки",
+		"invalid or expired activation token":           "недействительный или просроченный токен активации",
+		"a user with this email address already exists": "пользователь с таким адресом электронной почты уже существует",
+
+		// Password rule messages.
+		"password must contain at least one digit":                "пароль должен содержать хотя бы одну цифру",
+		"password must contain at least one symbol":               "пароль должен содержать хотя бы один специальный символ",
+		"password must contain both upper and lower case letters": "пароль должен содержать буквы верхнего и нижнего регистра",
+
+		// Error response messages.
+		"the server encountered a problem and could not process your request":   "на сервере возникла проблема, и он не смог обработать ваш запрос",
+		"the requested resource could not be found":                             "запрошенный ресурс не найден",
+		"unable to update the record due to an edit conflict, please try again": "не удалось обновить запись из-за конфликта редактирования, попробуйте ещё раз",
+		"rate limit exceeded":                                                              "превышен лимит запросов",
+		"invalid authentication credentials":                                               "неверные учётные данные",
+		"invalid or missing authentication token":                                          "недействительный или отсутствующий токен аутентификации",
+		"you must be authenticated to access this resource":                                "для доступа к этому ресурсу необходимо пройти аутентификацию",
+		"your user account must be activated to access this resource":                      "для доступа к этому ресурсу ваша учётная запись должна быть активирована",
+		"your user account doesn't have the necessary permissions to access this resource": "у вашей учётной записи нет необходимых прав для доступа к этому ресурсу",
+		"the server is temporarily unable to handle your request, please try again later":  "сервер временно не может обработать ваш запрос, попробуйте позже",
+		"body must not be empty":                                                           "тело запроса не должно быть пустым",
+		"body contains badly-formed JSON":                                                  "тело запроса содержит некорректный JSON",
+		"body must only contain a single JSON value":                                       "тело запроса должно содержать только одно значение JSON",
+	},
+}
+
+// Supported reports whether there are translations available for a language.
+func Supported(lang string) bool {
+	if lang == DefaultLanguage {
+		return true
+	}
+	_, ok := catalog[lang]
+	return ok
+}
+
+var numberRX = regexp.MustCompile(`[0-9]+`)
+
+// Translate returns the translation of message into lang, or the message unchanged if
+// no translation exists. A message without an exact entry is looked up again with its
+// numbers replaced by %d, and the numbers are put back into the translated template.
+func Translate(lang, message string) string {
+	if translated, ok := catalog[lang][message]; ok {
+		return translated
+	}
+	numbers := numberRX.FindAllString(message, -1)
+	if len(numbers) == 0 {
+		return message
+	}
+	translated, ok := catalog[lang][numberRX.ReplaceAllString(message, "%d")]
+	if !ok {
+		return message
+	}
+	args := make([]any, len(numbers))
+	for i, n := range numbers {
+		args[i] = n
+	}
+	return fmt.Sprintf(strings.ReplaceAll(translated, "%d", "%s"), args...)
+}
+
+// MatchLanguage parses the value of an Accept-Language header and returns the
+// supported language with the highest quality value. Region subtags are ignored, so
+// "ru-KZ" matches "ru". If none of the requested languages are supported,
+// DefaultLanguage is returned.
+func MatchLanguage(acceptLanguage string) string {
+	type tag struct {
+		lang    string
+		quality float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		lang, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(lang)), "-")
+		if lang == "" {
+			continue
+		}
+		quality := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			parsed, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		tags = append(tags, tag{lang: lang, quality: quality})
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		return tags[i].quality > tags[j].quality
+	})
+	for _, t := range tags {
+		if t.quality > 0 && Supported(t.lang) {
+			return t.lang
+		}
+	}
+	return DefaultLanguage
+}
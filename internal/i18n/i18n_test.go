@@ -0,0 +1,49 @@
+package i18n
+
+import "testing"
+
+func TestMatchLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", DefaultLanguage},
+		{"ru", "ru"},
+		{"ru-KZ", "ru"},
+		{"RU", "ru"},
+		{"de, ru;q=0.5", "ru"},
+		{"en;q=0.4, ru;q=0.8", "ru"},
+		{"ru;q=0.2, en;q=0.9", "en"},
+		{"ru;q=0", DefaultLanguage},
+		{"ru;q=abc, kk", DefaultLanguage},
+		{"kk, fr", DefaultLanguage},
+	}
+	for _, tt := range tests {
+		if got := MatchLanguage(tt.header); got != tt.want {
+			t.Errorf("MatchLanguage(%q) = %q; want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		lang    string
+		message string
+		want    string
+	}{
+		{"ru", "must be provided", "обязательное поле"},
+		{"ru", "must be at least 8 bytes long", "должен содержать не менее 8 байт"},
+		{"ru", "must be at least 12 bytes long", "должен содержать не менее 12 байт"},
+		{"ru", "must not be more than 72 bytes long", "должен содержать не более 72 байт"},
+		{"ru", "password must contain at least one digit", "пароль должен содержать хотя бы одну цифру"},
+		{"ru", "must be at least 3 widgets", "must be at least 3 widgets"},
+		{"ru", "no translation", "no translation"},
+		{"en", "must be provided", "must be provided"},
+		{"kk", "must be provided", "must be provided"},
+	}
+	for _, tt := range tests {
+		if got := Translate(tt.lang, tt.message); got != tt.want {
+			t.Errorf("Translate(%q, %q) = %q; want %q", tt.lang, tt.message, got, tt.want)
+		}
+	}
+}
@@ -13,6 +13,7 @@ type Level int8
 
 const (
 	LevelInfo Level = iota
+	LevelWarning
 	LevelError
 	LevelFatal
 	LevelOff
@@ -22,6 +23,8 @@ func (l Level) String() string {
 	switch l {
 	case LevelInfo:
 		return "INFO"
+	case LevelWarning:
+		return "WARNING"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
@@ -47,6 +50,9 @@ func New(out io.Writer, minLevel Level) *Logger {
 func (l *Logger) PrintInfo(message string, properties map[string]string) {
 	l.print(LevelInfo, message, properties)
 }
+func (l *Logger) PrintWarning(message string, properties map[string]string) {
+	l.print(LevelWarning, message, properties)
+}
 func (l *Logger) PrintError(err error, properties map[string]string) {
 	l.print(LevelError, err.Error(), properties)
 }
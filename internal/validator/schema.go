@@ -0,0 +1,211 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a JSON Schema document. Only the subset of keywords that we need for
+// validating request bodies is supported: type, properties, required,
+// additionalProperties (as a boolean), items, minItems, maxItems, minLength,
+// maxLength, pattern, minimum, maximum and enum.
+type Schema struct {
+	Type                 schemaTypes        `json:"type"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	Enum                 []any              `json:"enum"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes holds the value of the type keyword, which can either be a single
+// type name or an array of them.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(b, &multiple); err != nil {
+		return err
+	}
+	*t = multiple
+	return nil
+}
+
+// ParseSchema parses a JSON Schema document and compiles any patterns in it.
+func ParseSchema(b []byte) (*Schema, error) {
+	var s Schema
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return nil, err
+	}
+	err = s.compile()
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		rx, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = rx
+	}
+	for _, property := range s.Properties {
+		if err := property.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// Validate checks a decoded JSON document (as produced by json.Unmarshal into an
+// any value) against the schema. It returns a map of errors keyed by the path of the
+// offending value, such as "genres[2]", using "body" for the top-level value.
+func (s *Schema) Validate(doc any) map[string]string {
+	errs := make(map[string]string)
+	s.validate(doc, "", errs)
+	return errs
+}
+
+func (s *Schema) validate(value any, path string, errs map[string]string) {
+	key := path
+	if key == "" {
+		key = "body"
+	}
+	addError := func(message string) {
+		if _, exists := errs[key]; !exists {
+			errs[key] = message
+		}
+	}
+
+	if len(s.Type) > 0 && !PermittedValue(jsonType(value), s.Type...) {
+		// All integers are also numbers.
+		if !(jsonType(value) == "integer" && PermittedValue("number", s.Type...)) {
+			addError("must be of type " + strings.Join(s.Type, " or "))
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		found := false
+		for _, permitted := range s.Enum {
+			if permitted == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addError(fmt.Sprintf("must be one of %v", s.Enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := utf8.RuneCountInString(v)
+		if s.MinLength != nil && length < *s.MinLength {
+			addError(fmt.Sprintf("must be at least %d characters long", *s.MinLength))
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			addError(fmt.Sprintf("must not be more than %d characters long", *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			addError(fmt.Sprintf("must match the pattern %q", s.Pattern))
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			addError(fmt.Sprintf("must be at least %v", *s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			addError(fmt.Sprintf("must not be more than %v", *s.Maximum))
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			addError(fmt.Sprintf("must contain at least %d items", *s.MinItems))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			addError(fmt.Sprintf("must not contain more than %d items", *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				errs[joinPath(path, name)] = "must be provided"
+			}
+		}
+		// Check the properties in a consistent order, so that the same body always
+		// produces the same errors.
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			property, ok := s.Properties[name]
+			switch {
+			case ok:
+				property.validate(v[name], joinPath(path, name), errs)
+			case s.AdditionalProperties != nil && !*s.AdditionalProperties:
+				errs[joinPath(path, name)] = "is not a permitted field"
+			}
+		}
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// jsonType returns the JSON Schema type name for a decoded JSON value.
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return "unknown"
+	}
+}
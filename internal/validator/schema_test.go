@@ -0,0 +1,121 @@
+package validator
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["title", "genres"],
+	"additionalProperties": false,
+	"properties": {
+		"title": {"type": "string", "minLength": 1, "maxLength": 10},
+		"year": {"type": "integer", "minimum": 1888, "maximum": 2100},
+		"runtime": {"type": "string", "pattern": "^[0-9]+ mins$"},
+		"genres": {
+			"type": "array",
+			"minItems": 1,
+			"maxItems": 2,
+			"items": {"type": "string", "minLength": 1}
+		},
+		"status": {"type": "string", "enum": ["airing", "finished"]},
+		"episodes": {"type": ["integer", "null"]},
+		"score": {"type": "number"}
+	}
+}`
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ParseSchema([]byte(testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want map[string]string
+	}{
+		{
+			name: "valid",
+			body: `{"title": "Akira", "year": 1988, "runtime": "124 mins", "genres": ["Sci-Fi"], "status": "finished", "episodes": null, "score": 8}`,
+			want: map[string]string{},
+		},
+		{
+			name: "not an object",
+			body: `[]`,
+			want: map[string]string{"body": "must be of type object"},
+		},
+		{
+			name: "missing required fields",
+			body: `{}`,
+			want: map[string]string{"title": "must be provided", "genres": "must be provided"},
+		},
+		{
+			name: "unknown field",
+			body: `{"title": "Akira", "genres": ["Sci-Fi"], "rating": 5}`,
+			want: map[string]string{"rating": "is not a permitted field"},
+		},
+		{
+			name: "wrong types",
+			body: `{"title": 1, "genres": "Sci-Fi", "year": 1988.5, "episodes": "12"}`,
+			want: map[string]string{
+				"title":    "must be of type string",
+				"genres":   "must be of type array",
+				"year":     "must be of type integer",
+				"episodes": "must be of type integer or null",
+			},
+		},
+		{
+			name: "string constraints",
+			body: `{"title": "Neon Genesis Evangelion", "genres": [""], "runtime": "124 minutes"}`,
+			want: map[string]string{
+				"title":     "must not be more than 10 characters long",
+				"genres[0]": "must be at least 1 characters long",
+				"runtime":   `must match the pattern "^[0-9]+ mins$"`,
+			},
+		},
+		{
+			name: "length counts characters, not bytes",
+			body: `{"title": "進撃の巨人", "genres": ["Action"]}`,
+			want: map[string]string{},
+		},
+		{
+			name: "number and array constraints",
+			body: `{"title": "Akira", "year": 1800, "genres": ["a", "b", "c"]}`,
+			want: map[string]string{
+				"year":   "must be at least 1888",
+				"genres": "must not contain more than 2 items",
+			},
+		},
+		{
+			name: "enum",
+			body: `{"title": "Akira", "genres": ["Sci-Fi"], "status": "cancelled"}`,
+			want: map[string]string{"status": "must be one of [airing finished]"},
+		},
+		{
+			name: "integer is a number",
+			body: `{"title": "Akira", "genres": ["Sci-Fi"], "score": 7}`,
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc any
+			if err := json.Unmarshal([]byte(tt.body), &doc); err != nil {
+				t.Fatal(err)
+			}
+			if got := schema.Validate(doc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSchemaInvalidPattern(t *testing.T) {
+	_, err := ParseSchema([]byte(`{"properties": {"title": {"type": "string", "pattern": "("}}}`))
+	if err == nil {
+		t.Error("ParseSchema() with an invalid pattern: err = nil; want an error")
+	}
+}
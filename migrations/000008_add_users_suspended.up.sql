@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS suspended bool NOT NULL DEFAULT false;
+
+INSERT INTO permissions (code)
+VALUES ('users:admin');
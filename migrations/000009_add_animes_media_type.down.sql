@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS animes_media_type_idx;
+ALTER TABLE animes DROP CONSTRAINT IF EXISTS animes_media_type_check;
+ALTER TABLE animes DROP COLUMN IF EXISTS media_type;
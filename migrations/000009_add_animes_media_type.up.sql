@@ -0,0 +1,3 @@
+ALTER TABLE animes ADD COLUMN IF NOT EXISTS media_type text NOT NULL DEFAULT 'TV';
+ALTER TABLE animes ADD CONSTRAINT animes_media_type_check CHECK (media_type IN ('TV', 'Movie', 'OVA', 'Special'));
+CREATE INDEX IF NOT EXISTS animes_media_type_idx ON animes (media_type);
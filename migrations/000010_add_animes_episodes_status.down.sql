@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS animes_status_idx;
+ALTER TABLE animes DROP CONSTRAINT IF EXISTS animes_episodes_count_check;
+ALTER TABLE animes DROP CONSTRAINT IF EXISTS animes_status_check;
+ALTER TABLE animes DROP COLUMN IF EXISTS status;
+ALTER TABLE animes DROP COLUMN IF EXISTS episodes_count;
@@ -0,0 +1,5 @@
+ALTER TABLE animes ADD COLUMN IF NOT EXISTS episodes_count integer;
+ALTER TABLE animes ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'finished';
+ALTER TABLE animes ADD CONSTRAINT animes_status_check CHECK (status IN ('airing', 'finished', 'upcoming'));
+ALTER TABLE animes ADD CONSTRAINT animes_episodes_count_check CHECK (episodes_count IS NULL OR episodes_count > 0);
+CREATE INDEX IF NOT EXISTS animes_status_idx ON animes (status);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS animes_title_year_key;
@@ -0,0 +1 @@
+CREATE UNIQUE INDEX IF NOT EXISTS animes_title_year_key ON animes (lower(title), year);
@@ -0,0 +1,7 @@
+DELETE FROM permissions WHERE code = 'animes:admin';
+
+DELETE FROM animes WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS animes_title_year_key;
+CREATE UNIQUE INDEX IF NOT EXISTS animes_title_year_key ON animes (lower(title), year);
+
+ALTER TABLE animes DROP COLUMN IF EXISTS deleted_at;
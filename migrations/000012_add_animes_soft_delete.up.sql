@@ -0,0 +1,8 @@
+ALTER TABLE animes ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+-- Soft-deleted animes shouldn't block a new anime with the same title and year.
+DROP INDEX IF EXISTS animes_title_year_key;
+CREATE UNIQUE INDEX IF NOT EXISTS animes_title_year_key ON animes (lower(title), year) WHERE deleted_at IS NULL;
+
+INSERT INTO permissions (code)
+VALUES ('animes:admin');
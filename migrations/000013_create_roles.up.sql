@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    name text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+-- Make sure the permission codes used by the application exist.
+INSERT INTO permissions (code)
+SELECT wanted.code FROM unnest(ARRAY['animes:read', 'animes:write']) AS wanted(code)
+WHERE NOT EXISTS (SELECT 1 FROM permissions WHERE permissions.code = wanted.code);
+
+INSERT INTO roles (name)
+VALUES ('reader'), ('editor'), ('admin');
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles
+INNER JOIN permissions ON
+    (roles.name = 'reader' AND permissions.code = 'animes:read')
+    OR (roles.name = 'editor' AND permissions.code IN ('animes:read', 'animes:write'))
+    OR (roles.name = 'admin' AND permissions.code IN ('animes:read', 'animes:write', 'animes:admin', 'users:admin'));
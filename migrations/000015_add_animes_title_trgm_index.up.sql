@@ -0,0 +1,2 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS animes_title_trgm_idx ON animes USING GIN (lower(title) gin_trgm_ops);
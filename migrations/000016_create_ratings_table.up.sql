@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS ratings (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    anime_id bigint NOT NULL REFERENCES animes ON DELETE CASCADE,
+    score integer NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, anime_id),
+    CONSTRAINT ratings_score_check CHECK (score BETWEEN 1 AND 10)
+);
+
+CREATE INDEX IF NOT EXISTS ratings_anime_id_idx ON ratings (anime_id);
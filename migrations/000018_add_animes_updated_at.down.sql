@@ -0,0 +1 @@
+ALTER TABLE animes DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,8 @@
+ALTER TABLE animes ADD COLUMN IF NOT EXISTS created_by bigint REFERENCES users ON DELETE SET NULL;
+
+-- Animes created before this column existed are attributed using the audit log.
+UPDATE animes SET created_by = audit_log.user_id
+FROM audit_log
+WHERE audit_log.action = 'create' AND audit_log.target_type = 'anime' AND audit_log.target_id = animes.id;
+
+CREATE INDEX IF NOT EXISTS animes_created_by_idx ON animes (created_by);
@@ -0,0 +1,2 @@
+ALTER TABLE ratings DROP COLUMN IF EXISTS window_started_at;
+ALTER TABLE ratings DROP COLUMN IF EXISTS change_count;
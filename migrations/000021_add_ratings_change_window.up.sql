@@ -0,0 +1,2 @@
+ALTER TABLE ratings ADD COLUMN IF NOT EXISTS change_count integer NOT NULL DEFAULT 0;
+ALTER TABLE ratings ADD COLUMN IF NOT EXISTS window_started_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
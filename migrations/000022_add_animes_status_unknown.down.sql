@@ -0,0 +1,4 @@
+UPDATE animes SET status = 'finished' WHERE status = 'unknown';
+ALTER TABLE animes ALTER COLUMN status SET DEFAULT 'finished';
+ALTER TABLE animes DROP CONSTRAINT IF EXISTS animes_status_check;
+ALTER TABLE animes ADD CONSTRAINT animes_status_check CHECK (status IN ('airing', 'finished', 'upcoming'));
@@ -0,0 +1,4 @@
+ALTER TABLE animes DROP CONSTRAINT IF EXISTS animes_status_check;
+ALTER TABLE animes ADD CONSTRAINT animes_status_check CHECK (status IN ('airing', 'finished', 'upcoming', 'unknown'));
+ALTER TABLE animes ALTER COLUMN status SET DEFAULT 'unknown';
+UPDATE animes SET status = 'unknown' WHERE status = 'finished' AND episodes_count IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS animes_title_year_key;
+CREATE UNIQUE INDEX IF NOT EXISTS animes_title_key ON animes (lower(title)) WHERE deleted_at IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS animes_title_year_key;
+CREATE UNIQUE INDEX IF NOT EXISTS animes_title_year_media_type_key ON animes (lower(title), year, media_type) WHERE deleted_at IS NULL;